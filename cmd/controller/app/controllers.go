@@ -49,13 +49,24 @@ func StartControllers(ctx ControllerContext, controllers map[string]InitFunc) er
 }
 
 func startReleaseController(ctx ControllerContext) error {
+	// An empty field manager disables server-side apply.
+	fieldManager := ""
+	if ctx.Options.ServerSideApply {
+		fieldManager = ctx.Options.FieldManager
+	}
 	releaseController, err := release.NewReleaseController(
 		ctx.ClientPool,
 		ctx.Codec,
 		ctx.InformerStore,
 		ctx.KubeClient.ReleaseV1alpha1(),
+		ctx.KubeClient.CoreV1(),
 		ctx.InformerFactory.Release().V1alpha1().Releases(),
 		ctx.IgnoredKinds,
+		ctx.Resources,
+		ctx.Patches,
+		ctx.RenderCache,
+		int(ctx.Options.ConcurrentApplies),
+		fieldManager,
 		ctx.ReleaseResyncPeriod,
 	)
 	if err != nil {
@@ -22,25 +22,50 @@ type ReleaseServer struct {
 	// allowed to sync concurrently. Larger number = more responsive jobs,
 	// but more CPU (and network) load.
 	ConcurrentStatusSyncs int32
+	// ConcurrentApplies is the number of chart nodes of a release that are
+	// allowed to apply concurrently.
+	ConcurrentApplies int32
 	// ResyncPeriod describes the period of informer resync.
 	ResyncPeriod time.Duration
 	// ReleaseResyncPeriod is the resync period to invoke informer event handler.
 	ReleaseResyncPeriod time.Duration
+	// DiscoveryRefreshPeriod is the period to refresh api resources from api server.
+	DiscoveryRefreshPeriod time.Duration
 
 	HealthzPort int
 
 	// The number of releaseHistory to retain to allow rollback.
 	// Defaults to 50.
 	HistoryLimit int32
+
+	// Patches is the path of a file which contains post-render patches.
+	Patches string
+
+	// ServerSideApply applies resources of releases with server-side apply.
+	ServerSideApply bool
+	// FieldManager is the field manager name for server-side apply.
+	FieldManager string
+	// InstallOrder is a list of extra kinds in the format of Kind.group. They are
+	// installed after built-in kinds in the order and uninstalled in reversed order.
+	InstallOrder []string
+	// ChartCacheSize is the max number of cached charts.
+	ChartCacheSize int
+	// RenderCacheSize is the max number of cached render results.
+	RenderCacheSize int
 }
 
 // NewReleaseServer creates a new CMServer with a default config.
 func NewReleaseServer() *ReleaseServer {
 	return &ReleaseServer{
-		ConcurrentGCSyncs:     5,
-		ConcurrentStatusSyncs: 5,
-		ResyncPeriod:          5 * time.Minute,
-		ReleaseResyncPeriod:   30 * time.Second,
+		ConcurrentGCSyncs:      5,
+		ConcurrentStatusSyncs:  5,
+		ConcurrentApplies:      4,
+		ResyncPeriod:           5 * time.Minute,
+		ReleaseResyncPeriod:    30 * time.Second,
+		DiscoveryRefreshPeriod: 5 * time.Minute,
+		ChartCacheSize:         64,
+		RenderCacheSize:        256,
+		FieldManager:           "rudder",
 	}
 }
 
@@ -51,8 +76,16 @@ func (s *ReleaseServer) AddFlags(fs *pflag.FlagSet, allControllers []string) {
 		"A list of controllers to enable. All controllers: %s", strings.Join(allControllers, ", ")))
 	fs.Int32Var(&s.ConcurrentGCSyncs, "concurrent-gc-syncs", s.ConcurrentGCSyncs, "The number of garbage collector worker that are allowed to sync concurrently")
 	fs.Int32Var(&s.ConcurrentStatusSyncs, "concurrent-status-syncs", s.ConcurrentStatusSyncs, "The number of status controller worker that are allowed to sync concurrently")
+	fs.Int32Var(&s.ConcurrentApplies, "concurrent-applies", s.ConcurrentApplies, "The number of chart nodes of a release that are allowed to apply concurrently")
 	fs.DurationVar(&s.ResyncPeriod, "resync-period", s.ResyncPeriod, "ResyncPeriod describes the period of informer resync")
 	fs.DurationVar(&s.ReleaseResyncPeriod, "handler-resync-period", s.ReleaseResyncPeriod, "ReleaseResyncPeriod is the resync period to invoke informer event handler")
+	fs.DurationVar(&s.DiscoveryRefreshPeriod, "discovery-refresh-period", s.DiscoveryRefreshPeriod, "The period to refresh api resources. CRD changes also trigger refreshes")
 	fs.IntVar(&s.HealthzPort, "healthz-port", 8080, "The port of the localhost healthz endpoint")
 	fs.Int32Var(&s.HistoryLimit, "history-limit", 50, "The number of releaseHistory to retain to allow rollback")
+	fs.IntVar(&s.ChartCacheSize, "chart-cache-size", s.ChartCacheSize, "The max number of parsed charts to cache. Charts are shared by releases with same template")
+	fs.IntVar(&s.RenderCacheSize, "render-cache-size", s.RenderCacheSize, "The max number of render results to cache. Set 0 to disable the cache")
+	fs.StringVar(&s.Patches, "patches", s.Patches, "Path to a file of patches which are applied to rendered resources of releases")
+	fs.StringSliceVar(&s.InstallOrder, "install-order", s.InstallOrder, "A list of extra kinds in the format of Kind.group, such as Certificate.cert-manager.io. They are installed after built-in kinds in the order and uninstalled in reversed order")
+	fs.BoolVar(&s.ServerSideApply, "server-side-apply", s.ServerSideApply, "Apply resources of releases with server-side apply. The cluster must support it")
+	fs.StringVar(&s.FieldManager, "field-manager", s.FieldManager, "The field manager name for server-side apply")
 }
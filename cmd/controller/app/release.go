@@ -1,17 +1,21 @@
 package app
 
 import (
+	"expvar"
 	"fmt"
 	"net/http"
+	"reflect"
 	"time"
 
 	"github.com/caicloud/rudder/cmd/controller/app/options"
 	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
 	"github.com/caicloud/rudder/pkg/store"
 
 	"github.com/caicloud/clientset/informers"
 	"github.com/caicloud/clientset/kubernetes"
 	"github.com/caicloud/clientset/kubernetes/scheme"
+	apiextensionsv1beta1 "github.com/caicloud/clientset/pkg/apis/apiextensions/v1beta1"
 	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
 	"github.com/caicloud/go-common/kubernetes/client"
 	"github.com/caicloud/go-common/version"
@@ -24,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 )
@@ -49,6 +54,10 @@ type ControllerContext struct {
 	AvailableKinds []schema.GroupVersionKind
 	// IgnoredKinds provides kinds which need be ignored when deleted.
 	IgnoredKinds []schema.GroupVersionKind
+	// Patches are applied to rendered resources of all releases.
+	Patches []*render.Patch
+	// RenderCache caches charts and render results for all releases.
+	RenderCache *render.Cache
 	// Stop is the stop channel
 	Stop <-chan struct{}
 	// ReleaseResyncPeriod is the resync period to invoke informer event handler for release
@@ -94,6 +103,31 @@ func Run(s *options.ReleaseServer) error {
 		klog.Error(err)
 		return err
 	}
+	var patches []*render.Patch
+	if s.Patches != "" {
+		patches, err = render.LoadPatches(s.Patches)
+		if err != nil {
+			klog.Error(err)
+			return err
+		}
+		glog.Infof("Loaded %d post-render patches from %s", len(patches), s.Patches)
+	}
+	if len(s.InstallOrder) > 0 {
+		gks := make([]schema.GroupKind, len(s.InstallOrder))
+		for i, kind := range s.InstallOrder {
+			gks[i] = schema.ParseGroupKind(kind)
+		}
+		kube.RegisterKinds(gks...)
+		glog.Infof("Registered install order for kinds: %v", gks)
+	}
+	renderCache, err := render.NewCache(s.ChartCacheSize, s.RenderCacheSize)
+	if err != nil {
+		klog.Error(err)
+		return err
+	}
+	expvar.Publish("renderCache", expvar.Func(func() interface{} {
+		return renderCache.Stats()
+	}))
 	pool, err := kube.NewClientPool(scheme.Scheme, kubeConfig, resources)
 	if err != nil {
 		klog.Error(err)
@@ -101,7 +135,20 @@ func Run(s *options.ReleaseServer) error {
 	}
 	stop := wait.NeverStop
 	informerFactory := informers.NewSharedInformerFactory(kubeClient, s.ResyncPeriod)
-	informerStore := store.NewIntegrationStore(resources, informerFactory, stop)
+	informerStore := store.NewIntegrationStore(resources, informerFactory, pool, stop)
+	// Refresh api resources when CRDs are added, removed or served differently.
+	// So new kinds can be used without restarting.
+	refresher := kube.NewRefresher(resources, s.DiscoveryRefreshPeriod)
+	informerFactory.Apiextensions().V1beta1().CustomResourceDefinitions().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { refresher.Trigger() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if crdServingChanged(oldObj, newObj) {
+				refresher.Trigger()
+			}
+		},
+		DeleteFunc: func(obj interface{}) { refresher.Trigger() },
+	})
+	go refresher.Run(stop)
 	ctx := ControllerContext{
 		Options:             *s,
 		Scheme:              scheme.Scheme,
@@ -113,6 +160,8 @@ func Run(s *options.ReleaseServer) error {
 		InformerStore:       informerStore,
 		AvailableKinds:      AvailableKinds(),
 		IgnoredKinds:        IgnoredKinds(),
+		Patches:             patches,
+		RenderCache:         renderCache,
 		Stop:                stop,
 		ReleaseResyncPeriod: s.ReleaseResyncPeriod,
 		HistoryLimit:        s.HistoryLimit,
@@ -155,3 +204,31 @@ func IgnoredKinds() []schema.GroupVersionKind {
 		core.SchemeGroupVersion.WithKind("PersistentVolumeClaim"),
 	}
 }
+
+// crdServingChanged checks if a CRD update may change api resources. Resyncs
+// and status updates don't change the generation of a CRD, so only changes of
+// spec (such as versions and names), accepted names and the Established
+// condition are taken into account.
+func crdServingChanged(oldObj, newObj interface{}) bool {
+	oldCRD, ok := oldObj.(*apiextensionsv1beta1.CustomResourceDefinition)
+	if !ok {
+		return true
+	}
+	newCRD, ok := newObj.(*apiextensionsv1beta1.CustomResourceDefinition)
+	if !ok {
+		return true
+	}
+	return oldCRD.Generation != newCRD.Generation ||
+		!reflect.DeepEqual(oldCRD.Status.AcceptedNames, newCRD.Status.AcceptedNames) ||
+		crdEstablished(oldCRD) != crdEstablished(newCRD)
+}
+
+// crdEstablished checks if the Established condition of a CRD is True.
+func crdEstablished(crd *apiextensionsv1beta1.CustomResourceDefinition) bool {
+	for _, c := range crd.Status.Conditions {
+		if c.Type == apiextensionsv1beta1.Established {
+			return c.Status == apiextensionsv1beta1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/storage"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -17,6 +18,7 @@ func init() {
 	fs.StringVarP(&createOptions.Values, "values", "c", "", "Chart values file path. Override values.yaml in template")
 	fs.StringVarP(&createOptions.Template, "template", "t", "", "Chart template file path. Can be a tgz package or a chart directory")
 	fs.StringVarP(&createOptions.KubeconfigPath, "kubeconfig", "k", "", "Kubernetes config path")
+	fs.BoolVar(&createOptions.DryRun, "dry-run", false, "Only check if resources would be accepted by kubernetes. Results are shown by get")
 }
 
 var createOptions = struct {
@@ -26,6 +28,7 @@ var createOptions = struct {
 	Namespace      string
 	Values         string
 	Template       string
+	DryRun         bool
 }{}
 
 var create = &cobra.Command{
@@ -68,6 +71,9 @@ func runCreate(cmd *cobra.Command, args []string) {
 	rel.Name = args[0]
 	rel.Spec.Config = config
 	rel.Spec.Template = template
+	if createOptions.DryRun {
+		rel.Annotations = map[string]string{storage.AnnotationDryRun: "true"}
+	}
 	r, err := clientset.ReleaseV1alpha1().Releases(createOptions.Namespace).Create(rel)
 	if err != nil {
 		glog.Fatalln(err)
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 
+	"github.com/caicloud/rudder/pkg/storage"
 	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -94,6 +95,26 @@ func runGet(cmd *cobra.Command, args []string) {
 	}
 	printTable(details)
 
+	if renderErr, err := storage.RenderError(r); err != nil {
+		glog.Errorf("Invalid render error of release: %v", err)
+	} else if renderErr != nil {
+		printRenderError(renderErr)
+		fmt.Println()
+	}
+
+	if results, err := storage.DryRunResults(r); err != nil {
+		glog.Errorf("Invalid dry-run results of release: %v", err)
+	} else if results != nil {
+		printDryRunResults(results)
+		fmt.Println()
+	}
+
+	if notes := r.Annotations[storage.AnnotationNotes]; notes != "" {
+		fmt.Println("Notes:")
+		fmt.Println(notes)
+		fmt.Println()
+	}
+
 	fmt.Println("Config(YAML):")
 	cfg, err := yaml.JSONToYAML([]byte(r.Spec.Config))
 	if err != nil {
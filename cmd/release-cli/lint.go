@@ -1,15 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
-	"reflect"
+	"os"
 
 	"github.com/caicloud/rudder/pkg/render"
 
-	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes/any"
 	"github.com/spf13/cobra"
+	"k8s.io/helm/pkg/chartutil"
 )
 
 func init() {
@@ -17,16 +19,20 @@ func init() {
 	fs := lint.Flags()
 
 	fs.StringVarP(&lintOptions.Values, "values", "c", "", "Chart values file path. Override values.yaml in template")
-	fs.StringVarP(&lintOptions.Standard, "standard", "s", "", "Standard Chart values file path")
+	fs.StringVarP(&lintOptions.Schema, "schema", "s", "", "Values schema file path. Override values.schema.json in template")
 	fs.StringVarP(&lintOptions.Template, "template", "t", "", "Chart template file path. Can be a tgz package or a chart directory")
 	fs.BoolVarP(&lintOptions.Detail, "detail", "d", false, "Show details")
+	fs.StringVarP(&lintOptions.Capabilities, "capabilities", "a", "", "Capabilities file path. Provides api versions and kube version for templates")
+	fs.StringVarP(&lintOptions.Patches, "patches", "p", "", "Patches file path. Patches are applied to rendered resources")
 }
 
 var lintOptions = struct {
-	Values   string
-	Template string
-	Detail   bool
-	Standard string
+	Values       string
+	Template     string
+	Detail       bool
+	Schema       string
+	Capabilities string
+	Patches      string
 }{}
 
 var lint = &cobra.Command{
@@ -44,24 +50,28 @@ func runLint(cmd *cobra.Command, args []string) {
 		glog.Fatalf("Unable to load template and values: %v", err)
 	}
 
-	if lintOptions.Standard != "" {
-		standardValues, err := ioutil.ReadFile(lintOptions.Standard)
+	if lintOptions.Schema != "" {
+		data, err := ioutil.ReadFile(lintOptions.Schema)
 		if err != nil {
-			glog.Fatalf("Unable to load standard values: %v", err)
+			glog.Fatalf("Unable to load values schema: %v", err)
+		}
+		tpl, err = replaceSchema(tpl, data)
+		if err != nil {
+			glog.Fatalf("Unable to replace values schema: %v", err)
 		}
-		validateValues(string(standardValues), values)
 	}
 
-	r := render.NewRender()
-	c, err := r.Render(&render.Options{
-		Namespace: "default",
-		Release:   "release-name",
-		Version:   1,
-		Config:    values,
-		Template:  tpl,
-	})
+	c, err := renderOffline("default", "release-name", tpl, values, lintOptions.Capabilities, lintOptions.Patches)
 
 	if err != nil {
+		switch e := err.(type) {
+		case *render.SchemaError:
+			printViolations(e)
+			os.Exit(1)
+		case *render.RenderError:
+			printRenderError(e)
+			os.Exit(1)
+		}
 		glog.Fatalln(err)
 	}
 	if lintOptions.Detail {
@@ -69,93 +79,31 @@ func runLint(cmd *cobra.Command, args []string) {
 	}
 }
 
-func validateValues(standard, values string) {
-	standardMap, err := valuesPath(standard)
-	if err != nil {
-		glog.Error(err)
+// replaceSchema replaces the values schema of the top-level chart in an archived template.
+func replaceSchema(tpl []byte, schema []byte) ([]byte, error) {
+	if _, err := render.LoadSchema(schema); err != nil {
+		return nil, err
 	}
-	targetMap, err := valuesPath(values)
-	if err != nil {
-		glog.Error(err)
-	}
-	for path, types := range targetMap {
-		st := standardMap[path]
-		if len(st) <= 0 {
-			glog.Warningf("%s is not in standard", path)
-			continue
-		}
-		for _, t := range types {
-			valid := false
-			for _, s := range st {
-				if t == s {
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				glog.Errorf("%s has wrong type %s, must be in %v", path, t, st)
-			}
-		}
-	}
-}
-
-func valuesPath(values string) (map[string][]string, error) {
-	o := map[string]interface{}{}
-	err := yaml.Unmarshal([]byte(values), &o)
+	chart, err := chartutil.LoadArchive(bytes.NewReader(tpl))
 	if err != nil {
 		return nil, err
 	}
-	types := walkthrough("", o)
-	result := map[string][]string{}
-	for k, ts := range types {
-		arr := result[k]
-		for t := range ts {
-			arr = append(arr, t)
+	files := chart.Files[:0]
+	for _, f := range chart.Files {
+		if f.TypeUrl != render.SchemaFile {
+			files = append(files, f)
 		}
-		result[k] = arr
 	}
-	return result, nil
+	chart.Files = append(files, &any.Any{TypeUrl: render.SchemaFile, Value: schema})
+	return archive(chart)
 }
 
-func walkthrough(prefix string, obj interface{}) map[string]map[string]bool {
-	if obj == nil {
-		return nil
-	}
-	result := map[string]map[string]bool{}
-	switch target := obj.(type) {
-	case map[string]interface{}:
-		for k, v := range target {
-			r := walkthrough(prefix+"."+k, v)
-			mergeMap(result, r)
-		}
-	case []interface{}:
-		for _, o := range target {
-			r := walkthrough(prefix+"[]", o)
-			mergeMap(result, r)
-		}
-	case string:
-		result[prefix] = map[string]bool{reflect.String.String(): true}
-	case bool:
-		result[prefix] = map[string]bool{reflect.Bool.String(): true}
-	case float64:
-		result[prefix] = map[string]bool{reflect.Float64.String(): true}
-	default:
-		// Unreachable
-		glog.Fatalf("Unknown object type: %s", reflect.TypeOf(obj).String())
-	}
-	return result
-}
-
-func mergeMap(dst, src map[string]map[string]bool) {
-	for k, v := range src {
-		types := dst[k]
-		if types == nil {
-			types = v
-		} else {
-			for t := range v {
-				types[t] = true
-			}
-		}
-		dst[k] = types
+// printViolations prints all violations of values.
+func printViolations(err *render.SchemaError) {
+	fmt.Printf("Values of chart %s don't meet the schema:\n", err.Chart)
+	table := [][]string{{"PATH", "ERROR"}}
+	for _, v := range err.Violations {
+		table = append(table, []string{v.Path, v.Message})
 	}
+	printTable(table)
 }
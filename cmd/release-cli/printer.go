@@ -1,6 +1,12 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
+)
 
 func printTable(table [][]string) {
 	var widths []int
@@ -25,3 +31,45 @@ func printTable(table [][]string) {
 		fmt.Println()
 	}
 }
+
+// printRenderError prints a render error with its location.
+func printRenderError(err *render.RenderError) {
+	fmt.Printf("%s error:\n", err.Phase)
+	table := [][]string{}
+	if err.File != "" {
+		table = append(table, []string{"File:", err.File})
+	}
+	if err.Line > 0 {
+		table = append(table, []string{"Line:", strconv.Itoa(err.Line)})
+	}
+	if err.Column > 0 {
+		table = append(table, []string{"Column:", strconv.Itoa(err.Column)})
+	}
+	if err.Resource >= 0 {
+		table = append(table, []string{"Resource:", strconv.Itoa(err.Resource)})
+	}
+	if err.ValuePath != "" {
+		table = append(table, []string{"Value:", err.ValuePath})
+	}
+	table = append(table, []string{"Message:", err.Message})
+	printTable(table)
+}
+
+// printDryRunResults prints whether resources are accepted in dry-run.
+func printDryRunResults(results []kube.DryRunResult) {
+	fmt.Println("Dry Run Results:")
+	table := [][]string{
+		{"Kind", "Name", "Result", "Reason"},
+	}
+	for _, r := range results {
+		result := "Accepted"
+		switch {
+		case r.Skipped:
+			result = "Skipped"
+		case !r.Accepted:
+			result = "Rejected"
+		}
+		table = append(table, []string{r.Kind, r.Name, result, r.Reason})
+	}
+	printTable(table)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/caicloud/rudder/pkg/render"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	root.AddCommand(template)
+	fs := template.Flags()
+
+	fs.StringVarP(&templateOptions.Namespace, "namespace", "n", "default", "Namespace of the release")
+	fs.StringVarP(&templateOptions.Values, "values", "c", "", "Chart values file path. Override values.yaml in template")
+	fs.StringVarP(&templateOptions.Template, "template", "t", "", "Chart template file path. Can be a tgz package or a chart directory")
+	fs.StringVarP(&templateOptions.Capabilities, "capabilities", "a", "", "Capabilities file path. Provides api versions and kube version for templates")
+	fs.StringVarP(&templateOptions.Patches, "patches", "p", "", "Patches file path. Patches are applied to rendered resources")
+	fs.BoolVar(&templateOptions.Hooks, "hooks", false, "Show hooks after resources")
+}
+
+var templateOptions = struct {
+	Namespace    string
+	Values       string
+	Template     string
+	Capabilities string
+	Patches      string
+	Hooks        bool
+}{}
+
+var template = &cobra.Command{
+	Use:   "template",
+	Short: "Render a chart locally and show resources",
+	Run:   runTemplate,
+}
+
+func runTemplate(cmd *cobra.Command, args []string) {
+	if templateOptions.Template == "" {
+		glog.Fatalln("--template must be set")
+	}
+	if len(args) > 1 {
+		glog.Fatalln("Two or more release names is not allowed")
+	}
+	name := "release-name"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	tpl, values, err := loadChart(templateOptions.Template, templateOptions.Values)
+	if err != nil {
+		glog.Fatalf("Unable to load template and values: %v", err)
+	}
+
+	c, err := renderOffline(templateOptions.Namespace, name, tpl, values, templateOptions.Capabilities, templateOptions.Patches)
+	if err != nil {
+		switch e := err.(type) {
+		case *render.SchemaError:
+			printViolations(e)
+			os.Exit(1)
+		case *render.RenderError:
+			printRenderError(e)
+			os.Exit(1)
+		}
+		glog.Fatalln(err)
+	}
+	resources := c.Resources()
+	if templateOptions.Hooks {
+		for _, h := range c.Hooks() {
+			resources = append(resources, h.Resource)
+		}
+	}
+	fmt.Println(render.MergeResources(resources))
+}
@@ -4,10 +4,12 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
 
 	"github.com/caicloud/clientset/kubernetes"
+	"github.com/caicloud/rudder/pkg/render"
 
 	"github.com/ghodss/yaml"
 	"k8s.io/client-go/rest"
@@ -28,7 +30,7 @@ func loadChart(template string, values string) ([]byte, string, error) {
 			return nil, "", err
 		}
 		config = string(cfg)
-	} else {
+	} else if chart.Values != nil {
 		config = chart.Values.Raw
 	}
 	chart.Values = nil
@@ -39,6 +41,36 @@ func loadChart(template string, values string) ([]byte, string, error) {
 	return tpl, config, nil
 }
 
+// renderOffline renders a chart without a cluster. Capabilities and patches
+// are loaded from files if their paths are not empty.
+func renderOffline(namespace, name string, template []byte, values string, capabilities string, patches string) (render.Carrier, error) {
+	var caps render.CapabilitiesSource
+	if capabilities != "" {
+		static, err := render.LoadCapabilities(capabilities)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load capabilities: %v", err)
+		}
+		caps = static
+	}
+	var ps []*render.Patch
+	if patches != "" {
+		var err error
+		ps, err = render.LoadPatches(patches)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load patches: %v", err)
+		}
+	}
+	return render.NewRender().Render(&render.Options{
+		Namespace:    namespace,
+		Release:      name,
+		Version:      1,
+		Config:       values,
+		Template:     template,
+		Capabilities: caps,
+		Patches:      ps,
+	})
+}
+
 // zipper header
 var headerBytes = []byte("+aHR0cHM6Ly95b3V0dS5iZS96OVV6MWljandyTQo=")
 
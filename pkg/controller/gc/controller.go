@@ -13,6 +13,7 @@ import (
 	"github.com/caicloud/rudder/pkg/store"
 	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -99,14 +100,13 @@ func (r *releaseResources) resources(uid types.UID) []*resource {
 
 // set adds or updates object's owner's resource
 func (r *releaseResources) set(gvk schema.GroupVersionKind, obj runtime.Object) {
-	if r.ignored[gvk] {
+	if r.ignored[gvk] || kube.IsCRD(gvk) {
 		return
 	}
-	accessor, ok := obj.(metav1.ObjectMetaAccessor)
-	if !ok {
+	meta, err := apimeta.Accessor(obj)
+	if err != nil {
 		return
 	}
-	meta := accessor.GetObjectMeta()
 	owners := meta.GetOwnerReferences()
 	if len(owners) <= 0 || len(owners) >= 2 {
 		// If the resource have no owner reference or have two or more, we can't handle it.
@@ -143,11 +143,10 @@ func (r *releaseResources) set(gvk schema.GroupVersionKind, obj runtime.Object)
 }
 
 func (r *releaseResources) remove(obj runtime.Object) {
-	accessor, ok := obj.(metav1.ObjectMetaAccessor)
-	if !ok {
+	meta, err := apimeta.Accessor(obj)
+	if err != nil {
 		return
 	}
-	meta := accessor.GetObjectMeta()
 	owners := meta.GetOwnerReferences()
 	if len(owners) <= 0 || len(owners) >= 2 {
 		return
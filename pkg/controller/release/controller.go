@@ -5,20 +5,33 @@ import (
 
 	informerrelease "github.com/caicloud/clientset/informers/release/v1alpha1"
 	releasev1alpha1 "github.com/caicloud/clientset/kubernetes/typed/release/v1alpha1"
+	"github.com/caicloud/clientset/listerfactory"
 	listerrelease "github.com/caicloud/clientset/listers/release/v1alpha1"
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder-client/status"
 	"github.com/caicloud/rudder/pkg/kube"
 	"github.com/caicloud/rudder/pkg/release"
+	"github.com/caicloud/rudder/pkg/render"
 	"github.com/caicloud/rudder/pkg/storage"
 	"github.com/caicloud/rudder/pkg/store"
 	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
+var (
+	gvkConfigMap = core.SchemeGroupVersion.WithKind("ConfigMap")
+	gvkSecret    = core.SchemeGroupVersion.WithKind("Secret")
+)
+
 // Controller watches all resource related release and release history.
 type Controller struct {
 	queue            workqueue.RateLimitingInterface
@@ -33,16 +46,24 @@ func NewReleaseController(
 	codec kube.Codec,
 	store store.IntegrationStore,
 	releaseClient releasev1alpha1.ReleaseV1alpha1Interface,
+	secretClient corev1.SecretsGetter,
 	releaseInformer informerrelease.ReleaseInformer,
 	ignored []schema.GroupVersionKind,
+	resources kube.APIResources,
+	patches []*render.Patch,
+	renderCache *render.Cache,
+	concurrentApplies int,
+	fieldManager string,
 	reSyncPeriod time.Duration,
 ) (*Controller, error) {
 	client, err := kube.NewClientWithCacheLayer(clients, codec, store)
 	if err != nil {
 		return nil, err
 	}
-	handler := release.NewReleaseHandler(client, ignored)
-	backend := storage.NewReleaseBackendWithCacheLayer(releaseClient, store)
+	caps := render.NewCapabilitiesSource(resources)
+	umpire := status.NewUmpire(listerfactory.NewListerFactoryFromInformer(store.SharedInformerFactory()))
+	handler := release.NewReleaseHandler(client, ignored, caps, patches, store, renderCache, concurrentApplies, fieldManager, umpire, resources)
+	backend := storage.NewReleaseBackendWithCacheLayer(releaseClient, secretClient, store, caps, renderCache)
 	rc := &Controller{
 		queue:            workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
 		manager:          release.NewReleaseManager(backend, handler),
@@ -56,9 +77,78 @@ func NewReleaseController(
 		},
 		DeleteFunc: rc.enqueueRelease,
 	}, reSyncPeriod)
+	// Releases which refer to values in ConfigMaps or Secrets are triggered when
+	// the values are changed.
+	for _, gvk := range []schema.GroupVersionKind{gvkConfigMap, gvkSecret} {
+		gi, err := store.InformerFor(gvk)
+		if err != nil {
+			return nil, err
+		}
+		kind := gvk.Kind
+		gi.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				rc.enqueueReferrers(kind, obj)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldMeta, err := meta.Accessor(oldObj)
+				if err != nil {
+					return
+				}
+				newMeta, err := meta.Accessor(newObj)
+				if err != nil || oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+					return
+				}
+				rc.enqueueReferrers(kind, newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				rc.enqueueReferrers(kind, obj)
+			},
+		})
+	}
 	return rc, nil
 }
 
+// enqueueReferrers enqueues releases which refer to values in obj. kind is
+// the kind of obj.
+func (rc *Controller) enqueueReferrers(kind string, obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		glog.Errorf("Can't get meta of %s: %v", kind, err)
+		return
+	}
+	releases, err := rc.releaseLister.Releases(accessor.GetNamespace()).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Can't list releases in namespace %s: %v", accessor.GetNamespace(), err)
+		return
+	}
+	for _, r := range releases {
+		if referValues(r, kind, accessor.GetName()) {
+			glog.V(4).Infof("Values in %s %s/%s of release %s are changed", kind, accessor.GetNamespace(), accessor.GetName(), r.Name)
+			rc.enqueueRelease(r)
+		}
+	}
+}
+
+// referValues checks if a release refers to values in an object.
+func referValues(release *releaseapi.Release, kind, name string) bool {
+	layers, err := storage.ValuesLayers(release)
+	if err != nil {
+		return false
+	}
+	for _, layer := range layers {
+		switch {
+		case layer.ConfigMapKeyRef != nil && kind == gvkConfigMap.Kind && layer.ConfigMapKeyRef.Name == name:
+			return true
+		case layer.SecretKeyRef != nil && kind == gvkSecret.Kind && layer.SecretKeyRef.Name == name:
+			return true
+		}
+	}
+	return false
+}
+
 // keyForObj returns the key of obj.
 func (rc *Controller) keyForObj(obj interface{}) (string, error) {
 	return cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
@@ -23,8 +23,10 @@ import (
 	"github.com/caicloud/rudder/pkg/store"
 	"github.com/golang/glog"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/informers"
@@ -326,7 +328,11 @@ func (sc *Controller) detect(release *releaseapi.Release) (map[string]releaseapi
 			}
 			status := releaseapi.ResourceStatusFrom(releaseapi.ResourceProgressing)
 			var statistics *releaseapi.PodStatistics
-			if err == nil {
+			if _, ok := runningObj.(*unstructured.Unstructured); ok && err == nil {
+				// The umpire can't judge unstructured objects, such as instances
+				// of CRDs. They are running once they exist.
+				status = releaseapi.ResourceStatusFrom(releaseapi.ResourceRunning)
+			} else if err == nil {
 				// There is no gvk in runningObj. We set it here.
 				runningObj.GetObjectKind().SetGroupVersionKind(gvk)
 				status, err = sc.umpire.Judge(runningObj)
@@ -364,6 +370,9 @@ func (sc *Controller) detect(release *releaseapi.Release) (map[string]releaseapi
 			if status.Phase == releaseapi.ResourceFailed {
 				detail.Reason = status.Reason
 				detail.Message = status.Message
+			} else if pvc, ok := runningObj.(*corev1.PersistentVolumeClaim); ok && detail.Reason == "" {
+				// Surface resize progress of expanded volumes.
+				detail.Reason, detail.Message = resizeProgress(pvc)
 			}
 
 			detail.Resources[key] = counter
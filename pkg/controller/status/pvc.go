@@ -0,0 +1,28 @@
+package status
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// resizeProgress returns the reason and message if a PVC is being resized.
+// It returns empty strings if the PVC is not being resized.
+func resizeProgress(pvc *corev1.PersistentVolumeClaim) (string, string) {
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case corev1.PersistentVolumeClaimResizing, corev1.PersistentVolumeClaimFileSystemResizePending:
+			capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+			request := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			message := fmt.Sprintf("PersistentVolumeClaim %s is resizing from %s to %s", pvc.Name, capacity.String(), request.String())
+			if condition.Message != "" {
+				message += ": " + condition.Message
+			}
+			return string(condition.Type), message
+		}
+	}
+	return "", ""
+}
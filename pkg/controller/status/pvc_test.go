@@ -0,0 +1,62 @@
+package status
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResizeProgress(t *testing.T) {
+	testCases := []struct {
+		name       string
+		conditions []corev1.PersistentVolumeClaimCondition
+		reason     string
+		message    string
+	}{
+		{"not resizing", nil, "", ""},
+		{
+			"resizing",
+			[]corev1.PersistentVolumeClaimCondition{
+				{Type: corev1.PersistentVolumeClaimResizing, Status: corev1.ConditionTrue},
+			},
+			"Resizing",
+			"PersistentVolumeClaim data is resizing from 1Gi to 2Gi",
+		},
+		{
+			"file system resize pending",
+			[]corev1.PersistentVolumeClaimCondition{
+				{Type: corev1.PersistentVolumeClaimFileSystemResizePending, Status: corev1.ConditionTrue, Message: "waiting for pod restart"},
+			},
+			"FileSystemResizePending",
+			"PersistentVolumeClaim data is resizing from 1Gi to 2Gi: waiting for pod restart",
+		},
+		{
+			"resizing is finished",
+			[]corev1.PersistentVolumeClaimCondition{
+				{Type: corev1.PersistentVolumeClaimResizing, Status: corev1.ConditionFalse},
+			},
+			"",
+			"",
+		},
+	}
+	for _, tc := range testCases {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("2Gi")},
+				},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Capacity:   corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+				Conditions: tc.conditions,
+			},
+		}
+		reason, message := resizeProgress(pvc)
+		if reason != tc.reason || message != tc.message {
+			t.Errorf("%s: got (%q, %q) but expected (%q, %q)", tc.name, reason, message, tc.reason, tc.message)
+		}
+	}
+}
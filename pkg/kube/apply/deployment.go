@@ -0,0 +1,32 @@
+package apply
+
+import (
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func init() {
+	RegisterApplier(apps.SchemeGroupVersion.WithKind("Deployment"), applyDeployment)
+	RegisterDetector(apps.SchemeGroupVersion.WithKind("Deployment"), detectDeployment)
+}
+
+func applyDeployment(current, desired runtime.Object) error {
+	if current == nil || desired == nil {
+		return nil
+	}
+	// Deployment's selector is immutable.
+	co := current.(*apps.Deployment)
+	do := desired.(*apps.Deployment)
+	do.Spec.Selector = co.Spec.Selector
+	return nil
+}
+
+func detectDeployment(current, desired runtime.Object) []string {
+	co := current.(*apps.Deployment)
+	do := desired.(*apps.Deployment)
+	if do.Spec.Selector != nil && !equality.Semantic.DeepEqual(do.Spec.Selector, co.Spec.Selector) {
+		return []string{"spec.selector"}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newDeployment(selector map[string]string) *apps.Deployment {
+	deploy := &apps.Deployment{}
+	if selector != nil {
+		deploy.Spec.Selector = &metav1.LabelSelector{MatchLabels: selector}
+	}
+	return deploy
+}
+
+func TestDetectDeployment(t *testing.T) {
+	testCases := []struct {
+		name    string
+		current *apps.Deployment
+		desired *apps.Deployment
+		fields  []string
+	}{
+		{
+			"same selector",
+			newDeployment(map[string]string{"app": "web"}),
+			newDeployment(map[string]string{"app": "web"}),
+			nil,
+		},
+		{
+			"selector is not set in desired",
+			newDeployment(map[string]string{"app": "web"}),
+			newDeployment(nil),
+			nil,
+		},
+		{
+			"selector is changed",
+			newDeployment(map[string]string{"app": "web"}),
+			newDeployment(map[string]string{"app": "api"}),
+			[]string{"spec.selector"},
+		},
+	}
+	for _, tc := range testCases {
+		if fields := detectDeployment(tc.current, tc.desired); !reflect.DeepEqual(fields, tc.fields) {
+			t.Errorf("%s: got changed fields %v but expected %v", tc.name, fields, tc.fields)
+		}
+	}
+}
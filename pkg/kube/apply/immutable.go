@@ -0,0 +1,30 @@
+package apply
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Detector returns paths of immutable fields which are changed from current
+// to desired. Fields which are not set in desired are defaulted by api server,
+// so they are not treated as changes.
+type Detector func(current, desired runtime.Object) []string
+
+var detectors = map[schema.GroupVersionKind]Detector{}
+
+// RegisterDetector registers a detector for specific gvk.
+func RegisterDetector(gvk schema.GroupVersionKind, detector Detector) {
+	detectors[gvk] = detector
+}
+
+// ImmutableChanges returns paths of changed immutable fields. It returns nil
+// if there is no detector for gvk.
+func ImmutableChanges(gvk schema.GroupVersionKind, current, desired runtime.Object) []string {
+	if current == nil || desired == nil {
+		return nil
+	}
+	if detector, ok := detectors[gvk]; ok {
+		return detector(current, desired)
+	}
+	return nil
+}
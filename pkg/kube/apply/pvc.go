@@ -2,20 +2,52 @@ package apply
 
 import (
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func init() {
 	RegisterApplier(core.SchemeGroupVersion.WithKind("PersistentVolumeClaim"), applyPVC)
+	RegisterDetector(core.SchemeGroupVersion.WithKind("PersistentVolumeClaim"), detectPVC)
 }
 
 func applyPVC(current, desired runtime.Object) error {
 	if current == nil || desired == nil {
 		return nil
 	}
-	// PVC's spec is immutable.
+	// PVC's spec is immutable except the storage request. Volumes may be
+	// expanded by a larger request.
 	co := current.(*core.PersistentVolumeClaim)
 	do := desired.(*core.PersistentVolumeClaim)
-	do.Spec = co.Spec
+	size, ok := do.Spec.Resources.Requests[core.ResourceStorage]
+	do.Spec = *co.Spec.DeepCopy()
+	if ok && size.Cmp(co.Spec.Resources.Requests[core.ResourceStorage]) > 0 {
+		if do.Spec.Resources.Requests == nil {
+			do.Spec.Resources.Requests = core.ResourceList{}
+		}
+		do.Spec.Resources.Requests[core.ResourceStorage] = size
+	}
 	return nil
 }
+
+func detectPVC(current, desired runtime.Object) []string {
+	co := current.(*core.PersistentVolumeClaim)
+	do := desired.(*core.PersistentVolumeClaim)
+	fields := []string{}
+	if len(do.Spec.AccessModes) > 0 && !equality.Semantic.DeepEqual(do.Spec.AccessModes, co.Spec.AccessModes) {
+		fields = append(fields, "spec.accessModes")
+	}
+	if do.Spec.Selector != nil && !equality.Semantic.DeepEqual(do.Spec.Selector, co.Spec.Selector) {
+		fields = append(fields, "spec.selector")
+	}
+	if do.Spec.StorageClassName != nil && !equality.Semantic.DeepEqual(do.Spec.StorageClassName, co.Spec.StorageClassName) {
+		fields = append(fields, "spec.storageClassName")
+	}
+	if do.Spec.VolumeName != "" && do.Spec.VolumeName != co.Spec.VolumeName {
+		fields = append(fields, "spec.volumeName")
+	}
+	if do.Spec.VolumeMode != nil && !equality.Semantic.DeepEqual(do.Spec.VolumeMode, co.Spec.VolumeMode) {
+		fields = append(fields, "spec.volumeMode")
+	}
+	return fields
+}
@@ -0,0 +1,134 @@
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// claim describes the spec of a PVC.
+type claim struct {
+	accessMode   core.PersistentVolumeAccessMode
+	storageClass string
+	volumeName   string
+	storage      string
+}
+
+func newPVC(c claim) *core.PersistentVolumeClaim {
+	pvc := &core.PersistentVolumeClaim{}
+	if c.accessMode != "" {
+		pvc.Spec.AccessModes = []core.PersistentVolumeAccessMode{c.accessMode}
+	}
+	if c.storageClass != "" {
+		class := c.storageClass
+		pvc.Spec.StorageClassName = &class
+	}
+	pvc.Spec.VolumeName = c.volumeName
+	if c.storage != "" {
+		pvc.Spec.Resources.Requests = core.ResourceList{core.ResourceStorage: resource.MustParse(c.storage)}
+	}
+	return pvc
+}
+
+func TestDetectPVC(t *testing.T) {
+	bound := claim{core.ReadWriteOnce, "ssd", "pv-1", "1Gi"}
+	testCases := []struct {
+		name    string
+		current *core.PersistentVolumeClaim
+		desired *core.PersistentVolumeClaim
+		fields  []string
+	}{
+		{
+			"same spec",
+			newPVC(bound),
+			newPVC(claim{core.ReadWriteOnce, "ssd", "", "1Gi"}),
+			[]string{},
+		},
+		{
+			"defaulted fields are not set in desired",
+			newPVC(bound),
+			newPVC(claim{storage: "1Gi"}),
+			[]string{},
+		},
+		{
+			"storage requests are mutable",
+			newPVC(bound),
+			newPVC(claim{core.ReadWriteOnce, "ssd", "", "2Gi"}),
+			[]string{},
+		},
+		{
+			"access modes, storage class and volume name are changed",
+			newPVC(bound),
+			newPVC(claim{core.ReadWriteMany, "hdd", "pv-2", "1Gi"}),
+			[]string{"spec.accessModes", "spec.storageClassName", "spec.volumeName"},
+		},
+		{
+			"selector is changed",
+			newPVC(bound),
+			func() *core.PersistentVolumeClaim {
+				pvc := newPVC(bound)
+				pvc.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"disk": "ssd"}}
+				return pvc
+			}(),
+			[]string{"spec.selector"},
+		},
+	}
+	for _, tc := range testCases {
+		if fields := detectPVC(tc.current, tc.desired); !reflect.DeepEqual(fields, tc.fields) {
+			t.Errorf("%s: got changed fields %v but expected %v", tc.name, fields, tc.fields)
+		}
+	}
+}
+
+func TestApplyPVC(t *testing.T) {
+	testCases := []struct {
+		name     string
+		current  claim
+		desired  claim
+		expected claim
+	}{
+		{
+			"spec is kept",
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "1Gi"},
+			claim{core.ReadWriteMany, "", "", "1Gi"},
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "1Gi"},
+		},
+		{
+			"larger storage request is applied",
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "1Gi"},
+			claim{core.ReadWriteOnce, "ssd", "", "2Gi"},
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "2Gi"},
+		},
+		{
+			"smaller storage request is not applied",
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "2Gi"},
+			claim{core.ReadWriteOnce, "ssd", "", "1Gi"},
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "2Gi"},
+		},
+		{
+			"storage request is added",
+			claim{core.ReadWriteOnce, "ssd", "pv-1", ""},
+			claim{core.ReadWriteOnce, "ssd", "", "1Gi"},
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "1Gi"},
+		},
+		{
+			"storage request is removed",
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "1Gi"},
+			claim{core.ReadWriteOnce, "ssd", "", ""},
+			claim{core.ReadWriteOnce, "ssd", "pv-1", "1Gi"},
+		},
+	}
+	for _, tc := range testCases {
+		desired := newPVC(tc.desired)
+		if err := applyPVC(newPVC(tc.current), desired); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if expected := newPVC(tc.expected); !reflect.DeepEqual(desired.Spec, expected.Spec) {
+			t.Errorf("%s: got %+v but expected %+v", tc.name, desired.Spec, expected.Spec)
+		}
+	}
+}
@@ -7,8 +7,55 @@ import (
 
 func init() {
 	RegisterApplier(core.SchemeGroupVersion.WithKind("Service"), applyService)
+	RegisterDetector(core.SchemeGroupVersion.WithKind("Service"), detectService)
+	RegisterStrategist(core.SchemeGroupVersion.WithKind("Service"), serviceStrategy)
 }
 
+// servicePort is the key of a service port.
+type servicePort struct {
+	port     int32
+	protocol core.Protocol
+}
+
+// keyOf returns the key of a port. Empty protocol is TCP by default.
+func keyOf(port core.ServicePort) servicePort {
+	protocol := port.Protocol
+	if protocol == "" {
+		protocol = core.ProtocolTCP
+	}
+	return servicePort{port.Port, protocol}
+}
+
+// usesNodePorts checks if node ports are allocated for a service.
+func usesNodePorts(svc *core.Service) bool {
+	return svc.Spec.Type == core.ServiceTypeNodePort || svc.Spec.Type == core.ServiceTypeLoadBalancer
+}
+
+// usesHealthCheckNodePort checks if a health check node port is allocated for a service.
+func usesHealthCheckNodePort(svc *core.Service) bool {
+	return svc.Spec.Type == core.ServiceTypeLoadBalancer &&
+		svc.Spec.ExternalTrafficPolicy == core.ServiceExternalTrafficPolicyTypeLocal
+}
+
+// externalName checks if a service is an alias of an external name. Such
+// services have no cluster IP and no node ports.
+func externalName(svc *core.Service) bool {
+	return svc.Spec.Type == core.ServiceTypeExternalName
+}
+
+// headless checks if a service is headless.
+func headless(svc *core.Service) bool {
+	return svc.Spec.ClusterIP == core.ClusterIPNone
+}
+
+// applyService keeps values allocated by api server:
+//  - The cluster IP is kept unless the desired service is ExternalName.
+//    Switching to or from headless is handled by recreation.
+//  - Node ports are kept if both services use node ports (NodePort or
+//    LoadBalancer), and the desired node port is not specified.
+//  - Node ports are cleared if the desired service doesn't use node ports.
+//  - The health check node port is kept if both services need it, and cleared
+//    if the desired service doesn't need it.
 func applyService(current, desired runtime.Object) error {
 	if current == nil || desired == nil {
 		return nil
@@ -16,12 +63,16 @@ func applyService(current, desired runtime.Object) error {
 	co := current.(*core.Service)
 	do := desired.(*core.Service)
 	do.ResourceVersion = co.ResourceVersion
-	do.Spec.ClusterIP = co.Spec.ClusterIP
-	if do.Spec.Type == core.ServiceTypeNodePort &&
-		co.Spec.Type == core.ServiceTypeNodePort {
-		portsMap := map[int32]int32{}
+	if externalName(do) {
+		do.Spec.ClusterIP = ""
+	} else {
+		do.Spec.ClusterIP = co.Spec.ClusterIP
+	}
+	switch {
+	case usesNodePorts(do) && usesNodePorts(co):
+		portsMap := map[servicePort]int32{}
 		for _, port := range co.Spec.Ports {
-			portsMap[port.Port] = port.NodePort
+			portsMap[keyOf(port)] = port.NodePort
 		}
 		for i, port := range do.Spec.Ports {
 			// Node port should always between 1 and 65535.
@@ -29,9 +80,53 @@ func applyService(current, desired runtime.Object) error {
 			// random port or be same as current service.
 			if port.NodePort <= 0 || port.NodePort > 65535 {
 				// Set desired service's node port.
-				do.Spec.Ports[i].NodePort = portsMap[port.Port]
+				do.Spec.Ports[i].NodePort = portsMap[keyOf(port)]
 			}
 		}
+	case !usesNodePorts(do):
+		for i := range do.Spec.Ports {
+			do.Spec.Ports[i].NodePort = 0
+		}
+	}
+	switch {
+	case !usesHealthCheckNodePort(do):
+		do.Spec.HealthCheckNodePort = 0
+	case usesHealthCheckNodePort(co) && do.Spec.HealthCheckNodePort == 0:
+		do.Spec.HealthCheckNodePort = co.Spec.HealthCheckNodePort
 	}
 	return nil
 }
+
+func detectService(current, desired runtime.Object) []string {
+	co := current.(*core.Service)
+	do := desired.(*core.Service)
+	if externalName(co) || externalName(do) {
+		// ExternalName services have no cluster IP.
+		return nil
+	}
+	if headless(co) != headless(do) ||
+		(do.Spec.ClusterIP != "" && do.Spec.ClusterIP != co.Spec.ClusterIP) {
+		return []string{"spec.clusterIP"}
+	}
+	return nil
+}
+
+// serviceStrategy recreates a service when it's switched to or from headless.
+// A service which leaves node ports is replaced, because a patch can't remove
+// allocated node ports. A service which is switched to or from ExternalName is
+// also replaced, so the cluster IP is released or allocated.
+func serviceStrategy(current, desired runtime.Object) Strategy {
+	co := current.(*core.Service)
+	do := desired.(*core.Service)
+	if externalName(co) != externalName(do) {
+		return StrategyReplace
+	}
+	if headless(co) != headless(do) {
+		return StrategyRecreate
+	}
+	if (usesNodePorts(co) && !usesNodePorts(do)) ||
+		(usesHealthCheckNodePort(co) && !usesHealthCheckNodePort(do)) {
+		return StrategyReplace
+	}
+	return StrategyPatch
+}
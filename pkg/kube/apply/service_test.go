@@ -0,0 +1,214 @@
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+)
+
+// port is a service port with a node port.
+type port struct {
+	port     int32
+	nodePort int32
+}
+
+func newService(typ core.ServiceType, clusterIP string, healthCheckNodePort int32, ports ...port) *core.Service {
+	svc := &core.Service{
+		Spec: core.ServiceSpec{
+			Type:                typ,
+			ClusterIP:           clusterIP,
+			HealthCheckNodePort: healthCheckNodePort,
+		},
+	}
+	if healthCheckNodePort > 0 {
+		svc.Spec.ExternalTrafficPolicy = core.ServiceExternalTrafficPolicyTypeLocal
+	}
+	for _, p := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, core.ServicePort{
+			Port:     p.port,
+			NodePort: p.nodePort,
+		})
+	}
+	return svc
+}
+
+// local sets the external traffic policy of a service to Local.
+func local(svc *core.Service) *core.Service {
+	svc.Spec.ExternalTrafficPolicy = core.ServiceExternalTrafficPolicyTypeLocal
+	return svc
+}
+
+func TestApplyService(t *testing.T) {
+	testCases := []struct {
+		name     string
+		current  *core.Service
+		desired  *core.Service
+		expected *core.Service
+	}{
+		{
+			"ClusterIP to ClusterIP keeps cluster IP",
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, "", 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+		},
+		{
+			"NodePort to NodePort keeps allocated node ports",
+			newService(core.ServiceTypeNodePort, "10.0.0.1", 0, port{80, 30080}, port{443, 30443}),
+			newService(core.ServiceTypeNodePort, "", 0, port{80, 0}, port{443, 31443}, port{8080, 0}),
+			newService(core.ServiceTypeNodePort, "10.0.0.1", 0, port{80, 30080}, port{443, 31443}, port{8080, 0}),
+		},
+		{
+			"NodePort to ClusterIP clears node ports",
+			newService(core.ServiceTypeNodePort, "10.0.0.1", 0, port{80, 30080}),
+			newService(core.ServiceTypeClusterIP, "", 0, port{80, 30080}),
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+		},
+		{
+			"ClusterIP to NodePort leaves node ports to api server",
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+			newService(core.ServiceTypeNodePort, "", 0, port{80, 0}),
+			newService(core.ServiceTypeNodePort, "10.0.0.1", 0, port{80, 0}),
+		},
+		{
+			"NodePort to LoadBalancer keeps node ports",
+			newService(core.ServiceTypeNodePort, "10.0.0.1", 0, port{80, 30080}),
+			newService(core.ServiceTypeLoadBalancer, "", 0, port{80, 0}),
+			newService(core.ServiceTypeLoadBalancer, "10.0.0.1", 0, port{80, 30080}),
+		},
+		{
+			"LoadBalancer to LoadBalancer keeps node ports and health check node port",
+			newService(core.ServiceTypeLoadBalancer, "10.0.0.1", 32000, port{80, 30080}),
+			local(newService(core.ServiceTypeLoadBalancer, "", 0, port{80, 0})),
+			newService(core.ServiceTypeLoadBalancer, "10.0.0.1", 32000, port{80, 30080}),
+		},
+		{
+			"LoadBalancer to NodePort keeps node ports and clears health check node port",
+			newService(core.ServiceTypeLoadBalancer, "10.0.0.1", 32000, port{80, 30080}),
+			newService(core.ServiceTypeNodePort, "", 0, port{80, 0}),
+			newService(core.ServiceTypeNodePort, "10.0.0.1", 0, port{80, 30080}),
+		},
+		{
+			"LoadBalancer to ClusterIP clears all node ports",
+			newService(core.ServiceTypeLoadBalancer, "10.0.0.1", 32000, port{80, 30080}),
+			newService(core.ServiceTypeClusterIP, "", 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+		},
+		{
+			"ClusterIP to ExternalName clears cluster IP",
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+		},
+		{
+			"LoadBalancer to ExternalName clears cluster IP and all node ports",
+			newService(core.ServiceTypeLoadBalancer, "10.0.0.1", 32000, port{80, 30080}),
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 30080}),
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+		},
+		{
+			"ExternalName to NodePort leaves cluster IP and node ports to api server",
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+			newService(core.ServiceTypeNodePort, "", 0, port{80, 0}),
+			newService(core.ServiceTypeNodePort, "", 0, port{80, 0}),
+		},
+	}
+	for _, tc := range testCases {
+		if err := applyService(tc.current, tc.desired); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(tc.desired, tc.expected) {
+			t.Errorf("%s: got %+v but expected %+v", tc.name, tc.desired.Spec, tc.expected.Spec)
+		}
+	}
+}
+
+func TestServiceStrategy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		current  *core.Service
+		desired  *core.Service
+		strategy Strategy
+		fields   []string
+	}{
+		{
+			"ClusterIP to NodePort is patched",
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+			newService(core.ServiceTypeNodePort, "", 0, port{80, 0}),
+			StrategyPatch,
+			nil,
+		},
+		{
+			"NodePort to ClusterIP is replaced",
+			newService(core.ServiceTypeNodePort, "10.0.0.1", 0, port{80, 30080}),
+			newService(core.ServiceTypeClusterIP, "", 0, port{80, 0}),
+			StrategyReplace,
+			nil,
+		},
+		{
+			"LoadBalancer to NodePort is replaced",
+			newService(core.ServiceTypeLoadBalancer, "10.0.0.1", 32000, port{80, 30080}),
+			newService(core.ServiceTypeNodePort, "", 0, port{80, 0}),
+			StrategyReplace,
+			nil,
+		},
+		{
+			"ClusterIP to headless is recreated",
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, core.ClusterIPNone, 0, port{80, 0}),
+			StrategyRecreate,
+			[]string{"spec.clusterIP"},
+		},
+		{
+			"headless to ClusterIP is recreated",
+			newService(core.ServiceTypeClusterIP, core.ClusterIPNone, 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, "", 0, port{80, 0}),
+			StrategyRecreate,
+			[]string{"spec.clusterIP"},
+		},
+		{
+			"ClusterIP to ExternalName is replaced",
+			newService(core.ServiceTypeClusterIP, "10.0.0.1", 0, port{80, 0}),
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+			StrategyReplace,
+			nil,
+		},
+		{
+			"ExternalName to ClusterIP is replaced",
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, "", 0, port{80, 0}),
+			StrategyReplace,
+			nil,
+		},
+		{
+			"ExternalName to headless is replaced",
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, core.ClusterIPNone, 0, port{80, 0}),
+			StrategyReplace,
+			nil,
+		},
+		{
+			"ExternalName to ExternalName is patched",
+			newService(core.ServiceTypeExternalName, "", 0, port{80, 0}),
+			newService(core.ServiceTypeExternalName, "", 0, port{8080, 0}),
+			StrategyPatch,
+			nil,
+		},
+		{
+			"headless to headless is patched",
+			newService(core.ServiceTypeClusterIP, core.ClusterIPNone, 0, port{80, 0}),
+			newService(core.ServiceTypeClusterIP, core.ClusterIPNone, 0, port{8080, 0}),
+			StrategyPatch,
+			nil,
+		},
+	}
+	for _, tc := range testCases {
+		if strategy := serviceStrategy(tc.current, tc.desired); strategy != tc.strategy {
+			t.Errorf("%s: got strategy %v but expected %v", tc.name, strategy, tc.strategy)
+		}
+		if fields := detectService(tc.current, tc.desired); !reflect.DeepEqual(fields, tc.fields) {
+			t.Errorf("%s: got changed fields %v but expected %v", tc.name, fields, tc.fields)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package apply
 
 import (
+	"fmt"
+
 	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func init() {
 	RegisterApplier(apps.SchemeGroupVersion.WithKind("StatefulSet"), applyStatefulSet)
+	RegisterDetector(apps.SchemeGroupVersion.WithKind("StatefulSet"), detectStatefulSet)
 }
 
 func applyStatefulSet(current, desired runtime.Object) error {
@@ -24,3 +29,66 @@ func applyStatefulSet(current, desired runtime.Object) error {
 	do.Spec.UpdateStrategy = updateStrategy
 	return nil
 }
+
+func detectStatefulSet(current, desired runtime.Object) []string {
+	co := current.(*apps.StatefulSet)
+	do := desired.(*apps.StatefulSet)
+	fields := []string{}
+	if do.Spec.Selector != nil && !equality.Semantic.DeepEqual(do.Spec.Selector, co.Spec.Selector) {
+		fields = append(fields, "spec.selector")
+	}
+	if do.Spec.ServiceName != "" && do.Spec.ServiceName != co.Spec.ServiceName {
+		fields = append(fields, "spec.serviceName")
+	}
+	if do.Spec.PodManagementPolicy != "" && do.Spec.PodManagementPolicy != co.Spec.PodManagementPolicy {
+		fields = append(fields, "spec.podManagementPolicy")
+	}
+	if claimTemplatesChanged(co.Spec.VolumeClaimTemplates, do.Spec.VolumeClaimTemplates) {
+		fields = append(fields, "spec.volumeClaimTemplates")
+	}
+	return fields
+}
+
+// claimTemplatesChanged compares names, access modes and storage classes of
+// claim templates. Other fields may be defaulted. Storage requests are not
+// compared: a larger request should expand existing claims rather than recreate
+// the StatefulSet. They are reported by ClaimTemplateStorageChanges.
+func claimTemplatesChanged(current, desired []core.PersistentVolumeClaim) bool {
+	if len(current) != len(desired) {
+		return true
+	}
+	for i := range desired {
+		c, d := current[i], desired[i]
+		if c.Name != d.Name ||
+			!equality.Semantic.DeepEqual(c.Spec.AccessModes, d.Spec.AccessModes) ||
+			(d.Spec.StorageClassName != nil && !equality.Semantic.DeepEqual(c.Spec.StorageClassName, d.Spec.StorageClassName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimTemplateStorageChanges returns paths of storage requests which are
+// changed in claim templates of a StatefulSet. The changes are not applied,
+// because claim templates can't be updated and don't affect existing claims.
+// It returns nil if the objects are not StatefulSets or templates are added
+// or removed.
+func ClaimTemplateStorageChanges(current, desired runtime.Object) []string {
+	co, ok := current.(*apps.StatefulSet)
+	if !ok {
+		return nil
+	}
+	do, ok := desired.(*apps.StatefulSet)
+	if !ok || len(co.Spec.VolumeClaimTemplates) != len(do.Spec.VolumeClaimTemplates) {
+		return nil
+	}
+	var fields []string
+	for i, d := range do.Spec.VolumeClaimTemplates {
+		c := co.Spec.VolumeClaimTemplates[i]
+		size, ok := d.Spec.Resources.Requests[core.ResourceStorage]
+		if ok && !equality.Semantic.DeepEqual(size, c.Spec.Resources.Requests[core.ResourceStorage]) {
+			fields = append(fields, fmt.Sprintf("spec.volumeClaimTemplates[%d].spec.resources.requests.storage", i))
+		}
+	}
+	return fields
+}
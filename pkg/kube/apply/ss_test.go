@@ -0,0 +1,88 @@
+package apply
+
+import (
+	"reflect"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newStatefulSet(serviceName string, policy apps.PodManagementPolicyType, claims ...claim) *apps.StatefulSet {
+	ss := &apps.StatefulSet{
+		Spec: apps.StatefulSetSpec{
+			Selector:            &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			ServiceName:         serviceName,
+			PodManagementPolicy: policy,
+		},
+	}
+	for _, c := range claims {
+		pvc := newPVC(c)
+		pvc.Name = "data"
+		ss.Spec.VolumeClaimTemplates = append(ss.Spec.VolumeClaimTemplates, *pvc)
+	}
+	return ss
+}
+
+func TestDetectStatefulSet(t *testing.T) {
+	data := claim{core.ReadWriteOnce, "ssd", "", "1Gi"}
+	testCases := []struct {
+		name    string
+		current *apps.StatefulSet
+		desired *apps.StatefulSet
+		fields  []string
+		storage []string
+	}{
+		{
+			"same spec",
+			newStatefulSet("db", apps.ParallelPodManagement, data),
+			newStatefulSet("db", apps.ParallelPodManagement, data),
+			[]string{},
+			nil,
+		},
+		{
+			"defaulted fields are not set in desired",
+			newStatefulSet("db", apps.OrderedReadyPodManagement, data),
+			newStatefulSet("", "", claim{accessMode: core.ReadWriteOnce, storage: "1Gi"}),
+			[]string{},
+			nil,
+		},
+		{
+			"service name and pod management policy are changed",
+			newStatefulSet("db", apps.OrderedReadyPodManagement, data),
+			newStatefulSet("db-headless", apps.ParallelPodManagement, data),
+			[]string{"spec.serviceName", "spec.podManagementPolicy"},
+			nil,
+		},
+		{
+			"storage class of claim templates is changed",
+			newStatefulSet("db", "", data),
+			newStatefulSet("db", "", claim{core.ReadWriteOnce, "hdd", "", "1Gi"}),
+			[]string{"spec.volumeClaimTemplates"},
+			nil,
+		},
+		{
+			"claim templates are added",
+			newStatefulSet("db", "", data),
+			newStatefulSet("db", "", data, data),
+			[]string{"spec.volumeClaimTemplates"},
+			nil,
+		},
+		{
+			"storage requests of claim templates are reported but not a reason to recreate",
+			newStatefulSet("db", "", data),
+			newStatefulSet("db", "", claim{core.ReadWriteOnce, "ssd", "", "2Gi"}),
+			[]string{},
+			[]string{"spec.volumeClaimTemplates[0].spec.resources.requests.storage"},
+		},
+	}
+	for _, tc := range testCases {
+		if fields := detectStatefulSet(tc.current, tc.desired); !reflect.DeepEqual(fields, tc.fields) {
+			t.Errorf("%s: got changed fields %v but expected %v", tc.name, fields, tc.fields)
+		}
+		if storage := ClaimTemplateStorageChanges(tc.current, tc.desired); !reflect.DeepEqual(storage, tc.storage) {
+			t.Errorf("%s: got storage changes %v but expected %v", tc.name, storage, tc.storage)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package apply
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Strategy is the way to update an object.
+type Strategy int
+
+const (
+	// StrategyPatch patches the object. It's the default strategy.
+	StrategyPatch Strategy = iota
+	// StrategyReplace replaces the object by an update. Patches can't remove
+	// fields allocated by api server, but an update can.
+	StrategyReplace
+	// StrategyRecreate deletes the object and creates it again. It's used
+	// when immutable fields must be changed.
+	StrategyRecreate
+)
+
+// Strategist decides the strategy to update current to desired.
+type Strategist func(current, desired runtime.Object) Strategy
+
+var strategists = map[schema.GroupVersionKind]Strategist{}
+
+// RegisterStrategist registers a strategist for specific gvk.
+func RegisterStrategist(gvk schema.GroupVersionKind, strategist Strategist) {
+	strategists[gvk] = strategist
+}
+
+// StrategyFor returns the strategy to update current to desired.
+func StrategyFor(gvk schema.GroupVersionKind, current, desired runtime.Object) Strategy {
+	if current == nil || desired == nil {
+		return StrategyPatch
+	}
+	if strategist, ok := strategists[gvk]; ok {
+		return strategist(current, desired)
+	}
+	return StrategyPatch
+}
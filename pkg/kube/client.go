@@ -8,12 +8,12 @@ import (
 	"github.com/golang/glog"
 	"github.com/imdario/mergo"
 	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/kubernetes/pkg/api/legacyscheme"
 	k8spodutil "k8s.io/kubernetes/pkg/api/pod"
@@ -47,6 +47,9 @@ type Client interface {
 	Get(namespace string, resources []string, options GetOptions) ([]runtime.Object, error)
 	// Apply creates/updates all these resources.
 	Apply(namespace string, resources []string, options ApplyOptions) error
+	// DryRun applies all these resources with server-side dry-run. It returns
+	// whether every resource is accepted by the api server.
+	DryRun(namespace string, resources []string, options ApplyOptions) ([]DryRunResult, error)
 	// Create creates all these resources.
 	Create(namespace string, resources []string, options CreateOptions) error
 	// Update updates all resources.
@@ -78,19 +81,23 @@ type client struct {
 }
 
 func (c *client) getObject(gvk schema.GroupVersionKind, namespace, name string) (runtime.Object, error) {
+	client, err := c.pool.ClientFor(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
 	if c.layers != nil {
 		// Get object from cache.
 		layer, err := c.layers.LayerFor(gvk)
 		if err != nil {
 			return nil, err
 		}
+		if !client.resource.Namespaced {
+			// Cluster-scoped objects are keyed by names.
+			return layer.Get(name)
+		}
 		return layer.ByNamespace(namespace).Get(name)
 	}
 	// Get object by client.
-	client, err := c.pool.ClientFor(gvk, namespace)
-	if err != nil {
-		return nil, err
-	}
 	return client.Get(name, metav1.GetOptions{})
 }
 
@@ -133,92 +140,319 @@ func (c *client) Apply(namespace string, resources []string, options ApplyOption
 		return err
 	}
 	for _, obj := range objs {
-		gvk := obj.GetObjectKind().GroupVersionKind()
+		if err := c.applyObject(namespace, obj, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DryRun applies all these resources with dryRun=All. Nothing is persisted. It
+// returns a result for every resource instead of stopping at the first rejected
+// one.
+func (c *client) DryRun(namespace string, resources []string, options ApplyOptions) ([]DryRunResult, error) {
+	objs, err := c.objectsByOrder(resources, InstallOrder)
+	if err != nil {
+		return nil, err
+	}
+	options.DryRun = true
+	results := make([]DryRunResult, 0, len(objs))
+	for _, obj := range objs {
 		accessor, err := c.codec.AccessorForObject(obj)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if options.OwnerReferences != nil &&
-			// options.Checker is used to check if the object is belong to current owner.
-			// If not, add owner references to obj.
-			(options.Checker == nil || !options.Checker(obj)) {
-			accessor.SetOwnerReferences(append(accessor.GetOwnerReferences(), options.OwnerReferences...))
+		result := DryRunResult{
+			Kind:     obj.GetObjectKind().GroupVersionKind().Kind,
+			Name:     accessor.GetName(),
+			Accepted: true,
 		}
-		client, err := c.pool.ClientFor(gvk, namespace)
+		if err := c.applyObject(namespace, obj, options); err != nil {
+			result.Accepted = false
+			result.Reason = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// applyObject creates/updates an object.
+func (c *client) applyObject(namespace string, obj runtime.Object, options ApplyOptions) error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	accessor, err := c.codec.AccessorForObject(obj)
+	if err != nil {
+		return err
+	}
+	owner := ""
+	if IsCRD(gvk) {
+		// CRDs can't have owner references to namespaced owners.
+		owner = crdOwner(namespace, options.OwnerReferences)
+		setCRDOwner(accessor, owner)
+	} else if options.OwnerReferences != nil &&
+		// options.Checker is used to check if the object is belong to current owner.
+		// If not, add owner references to obj.
+		(options.Checker == nil || !options.Checker(obj)) {
+		accessor.SetOwnerReferences(append(accessor.GetOwnerReferences(), options.OwnerReferences...))
+	}
+	if !options.ServerSide {
+		if err := setLastApplied(accessor, obj); err != nil {
+			return err
+		}
+	}
+	client, err := c.pool.ClientFor(gvk, namespace)
+	if err != nil {
+		return err
+	}
+	var dryRun []string
+	if options.DryRun {
+		dryRun = []string{metav1.DryRunAll}
+	}
+	// Check whether the object exists.
+	existence, err := c.getObject(gvk, namespace, accessor.GetName())
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err != nil && options.ServerSide {
+		// Server-side apply creates the object.
+		return c.serverSideApply(client, gvk, accessor, obj, options, dryRun, false)
+	}
+	if err != nil {
+		// Create
+		result, err := client.CreateWithOptions(obj, metav1.CreateOptions{DryRun: dryRun})
 		if err != nil {
 			return err
 		}
-		// Check whether the object exists.
-		existence, err := c.getObject(gvk, namespace, accessor.GetName())
-		if err != nil && !errors.IsNotFound(err) {
+		if c.layers != nil && !options.DryRun {
+			// Record the result into cache.
+			layer, err := c.layers.LayerFor(gvk)
+			if err != nil {
+				return err
+			}
+			layer.Created(result)
+		}
+		return nil
+	}
+	// Update
+	if IsCRD(gvk) {
+		update, err := checkCRDOwner(owner, existence, obj)
+		if err != nil || !update {
 			return err
 		}
+	} else if !c.own(options.OwnerReferences, existence) &&
+		(options.Checker == nil || !options.Checker(obj)) {
+		// Conflict
+		return fmt.Errorf("%s/%s(%s) is not belong to current owner %v",
+			namespace, accessor.GetName(),
+			gvk.Kind, options.OwnerReferences)
+	}
+	// Job Cannot be update, so we must re-create Job
+	if gvk.Kind == "Job" {
+		if options.DryRun {
+			// The job would be re-created. Only check if it can be deleted.
+			return client.Delete(accessor.GetName(), &metav1.DeleteOptions{DryRun: dryRun})
+		}
+		return c.applyJob(client, gvk, obj, existence)
+	}
+	// Deployment/StatefulSet ip list decrease
+	if (gvk.Kind == "Deployment" || gvk.Kind == "StatefulSet") && !options.DryRun {
+		isIPDecreasing, err := judgeIPSpecDecreasing(obj, existence)
 		if err != nil {
-			// Create
-			result, err := client.Create(obj)
+			return err
+		}
+		if isIPDecreasing {
+			err = c.applyIPSpecDecreasing(client, namespace, obj, existence)
 			if err != nil {
 				return err
 			}
-			if c.layers != nil {
-				// Record the result into cache.
-				layer, err := c.layers.LayerFor(gvk)
-				if err != nil {
-					return err
-				}
-				layer.Created(result)
+		}
+	}
+	if gvk == core.SchemeGroupVersion.WithKind("PersistentVolumeClaim") {
+		if err := c.checkPVCExpansion(namespace, existence, obj, options); err != nil {
+			return err
+		}
+	}
+	strategy := apply.StrategyFor(gvk, existence, obj)
+	ignored := false
+	if fields := apply.ImmutableChanges(gvk, existence, obj); len(fields) > 0 {
+		policy, err := immutablePolicyFor(accessor, strategy == apply.StrategyRecreate)
+		if err != nil {
+			return err
+		}
+		if options.Recorder != nil {
+			options.Recorder(ImmutableDecision{
+				Kind:   gvk.Kind,
+				Name:   accessor.GetName(),
+				Fields: fields,
+				Policy: policy,
+			})
+		}
+		if policy != ImmutablePolicyIgnore {
+			return c.recreate(client, gvk, accessor, obj, policy, options, dryRun)
+		}
+		glog.Warningf("Immutable fields %v of %s/%s(%s) are changed and ignored", fields, namespace, accessor.GetName(), gvk.Kind)
+		ignored = true
+	}
+	if fields := apply.ClaimTemplateStorageChanges(existence, obj); len(fields) > 0 {
+		// Claim templates are kept by the applier. Existing claims should be
+		// expanded one by one.
+		glog.Warningf("Storage requests %v of %s/%s(%s) are changed and ignored", fields, namespace, accessor.GetName(), gvk.Kind)
+		ignored = true
+		if options.Recorder != nil {
+			options.Recorder(ImmutableDecision{
+				Kind:   gvk.Kind,
+				Name:   accessor.GetName(),
+				Fields: fields,
+				Policy: ImmutablePolicyIgnore,
+			})
+		}
+	}
+	// Server-side apply sends the object as rendered. Appliers copy fields of
+	// existence into obj, and those fields would be owned by rudder.
+	desired := obj.DeepCopyObject()
+	if err := apply.Apply(gvk, existence, obj); err != nil {
+		return err
+	}
+	if ignored {
+		// Ignored changes of immutable fields can only be kept by sending
+		// current values of these fields.
+		desired = obj
+	}
+	if strategy == apply.StrategyReplace {
+		// Fields allocated by api server can't be removed by patches.
+		result, err := client.UpdateWithOptions(obj, metav1.UpdateOptions{DryRun: dryRun, FieldManager: options.FieldManager})
+		if err != nil {
+			return err
+		}
+		if c.layers != nil && !options.DryRun {
+			// Record the result into cache.
+			layer, err := c.layers.LayerFor(gvk)
+			if err != nil {
+				return err
 			}
+			layer.Updated(result)
+		}
+		return nil
+	}
+	if options.ServerSide {
+		if err := c.clearLastApplied(client, existence, dryRun); err != nil {
+			return err
+		}
+		desiredAccessor, err := c.codec.AccessorForObject(desired)
+		if err != nil {
+			return err
+		}
+		return c.serverSideApply(client, gvk, desiredAccessor, desired, options, dryRun, true)
+	}
+	// Patch the object instead of updating it. Fields set by others are kept.
+	patchType, patch, err := c.patchFor(gvk, obj, existence)
+	if err != nil {
+		return err
+	}
+	if string(patch) == "{}" {
+		return nil
+	}
+	result, err := client.PatchWithOptions(accessor.GetName(), patchType, patch, metav1.PatchOptions{DryRun: dryRun})
+	if err != nil {
+		return err
+	}
+	if c.layers != nil && !options.DryRun {
+		// Record the result into cache.
+		layer, err := c.layers.LayerFor(gvk)
+		if err != nil {
+			return err
+		}
+		layer.Updated(result)
+	}
+	return nil
+}
+
+// serverSideApply applies obj with server-side apply. existing is true if the
+// object exists.
+func (c *client) serverSideApply(client *ResourceClient, gvk schema.GroupVersionKind, accessor metav1.Object, obj runtime.Object, options ApplyOptions, dryRun []string, existing bool) error {
+	if options.FieldManager == "" {
+		return fmt.Errorf("no field manager for server-side apply")
+	}
+	// Appliers may copy the resource version of current object. Don't take
+	// it as a precondition.
+	accessor.SetResourceVersion("")
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	force := options.Force
+	result, err := client.PatchWithOptions(accessor.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		DryRun:       dryRun,
+		Force:        &force,
+		FieldManager: options.FieldManager,
+	})
+	if err != nil {
+		if conflict := conflictError(gvk.Kind, accessor.GetName(), err); conflict != nil {
+			return conflict
+		}
+		return err
+	}
+	if c.layers != nil && !options.DryRun {
+		// Record the result into cache.
+		layer, err := c.layers.LayerFor(gvk)
+		if err != nil {
+			return err
+		}
+		if existing {
+			layer.Updated(result)
 		} else {
-			// Update
-			if c.own(options.OwnerReferences, existence) ||
-				(options.Checker != nil && options.Checker(obj)) {
-				// Job Cannot be update, so we must re-create Job
-				if gvk.Kind == "Job" {
-					err := c.applyJob(client, gvk, obj, existence)
-					if err != nil {
-						return err
-					}
-					continue
-				}
-				// Deployment/StatefulSet ip list decrease
-				if gvk.Kind == "Deployment" || gvk.Kind == "StatefulSet" {
-					isIPDecreasing, err := judgeIPSpecDecreasing(obj, existence)
-					if err != nil {
-						return err
-					}
-					if isIPDecreasing {
-						err = c.applyIPSpecDecreasing(client, namespace, obj, existence)
-						if err != nil {
-							return err
-						}
-					}
-				}
-				if err := apply.Apply(gvk, existence, obj); err != nil {
-					return err
-				}
-				result, err := client.Update(obj)
-				if err != nil {
-					return err
-				}
-				if c.layers != nil {
-					// Record the result into cache.
-					layer, err := c.layers.LayerFor(gvk)
-					if err != nil {
-						return err
-					}
-					layer.Updated(result)
-				}
-			} else {
-				glog.Errorf("%+v, %v", existence, err)
-				// Conflict
-				return fmt.Errorf("%s/%s(%s) is not belong to current owner %v",
-					namespace, accessor.GetName(),
-					gvk.Kind, options.OwnerReferences)
-			}
+			layer.Created(result)
 		}
 	}
 	return nil
 }
 
+// clearLastApplied removes the last applied configuration from existence. The
+// annotation is not updated by server-side apply, and would be stale if rudder
+// switches back to client-side apply.
+func (c *client) clearLastApplied(client *ResourceClient, existence runtime.Object, dryRun []string) error {
+	accessor, err := c.codec.AccessorForObject(existence)
+	if err != nil {
+		return err
+	}
+	if _, ok := accessor.GetAnnotations()[AnnotationLastApplied]; !ok {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				AnnotationLastApplied: nil,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.PatchWithOptions(accessor.GetName(), types.MergePatchType, patch, metav1.PatchOptions{DryRun: dryRun})
+	return err
+}
+
+// patchFor creates a three-way merge patch from the last applied configuration
+// of existence, desired obj and existence.
+func (c *client) patchFor(gvk schema.GroupVersionKind, obj, existence runtime.Object) (types.PatchType, []byte, error) {
+	current := existence.DeepCopyObject()
+	// Objects from cache have no gvk.
+	current.GetObjectKind().SetGroupVersionKind(gvk)
+	accessor, err := c.codec.AccessorForObject(current)
+	if err != nil {
+		return "", nil, err
+	}
+	original := []byte(accessor.GetAnnotations()[AnnotationLastApplied])
+	modified, err := json.Marshal(obj)
+	if err != nil {
+		return "", nil, err
+	}
+	currentData, err := json.Marshal(current)
+	if err != nil {
+		return "", nil, err
+	}
+	return threeWayPatch(gvk, original, modified, currentData)
+}
+
 func (c *client) applyJob(client *ResourceClient, gvk schema.GroupVersionKind, obj, existence runtime.Object) error {
 	desiredJob := obj.(*batchv1.Job)
 	currentJob := existence.(*batchv1.Job)
@@ -451,8 +685,7 @@ func (c *client) update(namespace string, updates []resources, options UpdateOpt
 		if err != nil {
 			return err
 		}
-		// TODO(kdada): Replace with merge patch when obj is TPR or CRD.
-		patch, err := strategicpatch.CreateTwoWayMergePatch([]byte(old), []byte(new), current)
+		patchType, patch, err := twoWayPatch(gvk, old, new)
 		if err != nil {
 			return err
 		}
@@ -464,7 +697,7 @@ func (c *client) update(namespace string, updates []resources, options UpdateOpt
 		if err != nil {
 			return err
 		}
-		result, err := client.Patch(accessor.GetName(), types.StrategicMergePatchType, patch)
+		result, err := client.Patch(accessor.GetName(), patchType, patch)
 		if err != nil {
 			return err
 		}
@@ -531,7 +764,7 @@ func (c *client) Delete(namespace string, resources []string, options DeleteOpti
 }
 
 // objectsByOrder converts resources and order by specified sort order.
-func (c *client) objectsByOrder(resources []string, order SortOrder) ([]runtime.Object, error) {
+func (c *client) objectsByOrder(resources []string, order *SortOrder) ([]runtime.Object, error) {
 	objs, err := c.codec.ResourcesToObjects(resources)
 	if err != nil {
 		return nil, err
@@ -2,11 +2,14 @@ package kube
 
 import (
 	"bytes"
-	"fmt"
+	"encoding/json"
 
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	jsonserializer "k8s.io/apimachinery/pkg/runtime/serializer/json"
 )
 
 // Codec converts between resources and objects.
@@ -30,20 +33,35 @@ type Codec interface {
 }
 
 // yamlCodec is a yaml codec. It converts between yaml resources and objects.
+// Kinds which are not registered in the scheme (such as instances of CRDs) are
+// converted to *unstructured.Unstructured.
 type yamlCodec struct {
-	serializer *json.Serializer
+	serializer *jsonserializer.Serializer
 }
 
 // NewYAMLCodec creates a codec with yaml serializer.
 func NewYAMLCodec(creator runtime.ObjectCreater, typer runtime.ObjectTyper) Codec {
 	return &yamlCodec{
-		serializer: json.NewYAMLSerializer(json.DefaultMetaFactory, creator, typer),
+		serializer: jsonserializer.NewYAMLSerializer(jsonserializer.DefaultMetaFactory, creator, typer),
 	}
 }
 
 // ResourceToObject converts a resource to a object.
 func (c *yamlCodec) ResourceToObject(resource string) (runtime.Object, error) {
 	obj, _, err := c.serializer.Decode([]byte(resource), nil, nil)
+	if err != nil && runtime.IsNotRegisteredError(err) {
+		return unstructuredFor(resource)
+	}
+	return obj, err
+}
+
+// unstructuredFor converts a yaml resource to an unstructured object.
+func unstructuredFor(resource string) (runtime.Object, error) {
+	data, err := yaml.YAMLToJSON([]byte(resource))
+	if err != nil {
+		return nil, err
+	}
+	obj, _, err := unstructured.UnstructuredJSONScheme.Decode(data, nil, nil)
 	return obj, err
 }
 
@@ -62,6 +80,14 @@ func (c *yamlCodec) ResourcesToObjects(resources []string) ([]runtime.Object, er
 
 // ObjectToResource converts object to resource.
 func (c *yamlCodec) ObjectToResource(obj runtime.Object) (string, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		data, err := json.Marshal(u)
+		if err != nil {
+			return "", err
+		}
+		data, err = yaml.JSONToYAML(data)
+		return string(data), err
+	}
 	buf := bytes.NewBuffer(nil)
 	err := c.serializer.Encode(obj, buf)
 	if err != nil {
@@ -85,11 +111,7 @@ func (c *yamlCodec) ObjectsToResources(objs []runtime.Object) ([]string, error)
 
 // AccessorForObject gets accessor from object.
 func (c *yamlCodec) AccessorForObject(obj runtime.Object) (metav1.Object, error) {
-	accessor, ok := obj.(metav1.ObjectMetaAccessor)
-	if !ok {
-		return nil, fmt.Errorf("unrecognized object")
-	}
-	return accessor.GetObjectMeta(), nil
+	return meta.Accessor(obj)
 }
 
 // AccessorForResource gets accessor from resource.
@@ -0,0 +1,80 @@
+package kube
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/caicloud/clientset/kubernetes/scheme"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// crontab is an instance of a CRD which is not registered in the scheme.
+const crontab = `apiVersion: stable.example.com/v1
+kind: CronTab
+metadata:
+  name: backup
+  namespace: default
+spec:
+  cronSpec: '* * * * */5'
+  image: backup:v1
+  replicas: 1
+`
+
+func TestUnregisteredKindRoundTrip(t *testing.T) {
+	codec := NewYAMLCodec(scheme.Scheme, scheme.Scheme)
+	obj, err := codec.ResourceToObject(crontab)
+	if err != nil {
+		t.Fatalf("can't decode resource: %v", err)
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		t.Fatalf("expected an unstructured object but got %T", obj)
+	}
+	gvk := schema.GroupVersionKind{Group: "stable.example.com", Version: "v1", Kind: "CronTab"}
+	if u.GroupVersionKind() != gvk || u.GetName() != "backup" || u.GetNamespace() != "default" {
+		t.Errorf("unexpected object: %v", u.Object)
+	}
+	if image, _, _ := unstructured.NestedString(u.Object, "spec", "image"); image != "backup:v1" {
+		t.Errorf("expected image backup:v1 but got %q", image)
+	}
+
+	resource, err := codec.ObjectToResource(obj)
+	if err != nil {
+		t.Fatalf("can't encode object: %v", err)
+	}
+	again, err := unstructuredFor(resource)
+	if err != nil {
+		t.Fatalf("can't decode encoded resource: %v", err)
+	}
+	if !reflect.DeepEqual(again, obj) {
+		t.Errorf("round trip changed the object: %v != %v", again, obj)
+	}
+
+	modified := u.DeepCopy()
+	if err := unstructured.SetNestedField(modified.Object, "backup:v2", "spec", "image"); err != nil {
+		t.Fatal(err)
+	}
+	unstructured.RemoveNestedField(modified.Object, "spec", "replicas")
+	original, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired, err := json.Marshal(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchType, patch, err := twoWayPatch(gvk, original, desired)
+	if err != nil {
+		t.Fatalf("can't create patch: %v", err)
+	}
+	if patchType != types.MergePatchType {
+		t.Errorf("expected a merge patch but got %s", patchType)
+	}
+	expected := `{"spec":{"image":"backup:v2","replicas":null}}`
+	if string(patch) != expected {
+		t.Errorf("expected patch %s but got %s", expected, patch)
+	}
+}
@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FieldConflict is a field which is managed by another manager.
+type FieldConflict struct {
+	// Manager is the name of the manager which owns the field.
+	Manager string `json:"manager"`
+	// Field is the path of the field. For example: .spec.replicas
+	Field string `json:"field"`
+}
+
+// ConflictError is returned when server-side apply conflicts with other
+// managers.
+type ConflictError struct {
+	// Kind is the kind of the object.
+	Kind string `json:"kind"`
+	// Name is the name of the object.
+	Name string `json:"name"`
+	// Conflicts contains all conflicting fields.
+	Conflicts []FieldConflict `json:"conflicts"`
+}
+
+func (e *ConflictError) Error() string {
+	fields := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		fields[i] = fmt.Sprintf("%s (managed by %q)", c.Field, c.Manager)
+	}
+	return fmt.Sprintf("%s %s has conflicting fields: %s", e.Kind, e.Name, strings.Join(fields, ", "))
+}
+
+// conflictManagerPattern matches messages of conflict causes:
+//  conflict with "kubectl" using apps/v1 at 2019-01-01T00:00:00Z
+var conflictManagerPattern = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+// conflictError converts a conflict error of server-side apply to a
+// ConflictError. It returns nil if err is not a conflict of field managers.
+func conflictError(kind, name string, err error) *ConflictError {
+	status, ok := err.(errors.APIStatus)
+	if !ok || !errors.IsConflict(err) || status.Status().Details == nil {
+		return nil
+	}
+	result := &ConflictError{Kind: kind, Name: name}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		conflict := FieldConflict{Field: cause.Field}
+		if m := conflictManagerPattern.FindStringSubmatch(cause.Message); m != nil {
+			conflict.Manager = m[1]
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+	if len(result.Conflicts) <= 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CRDGroupKind is the GroupKind of CustomResourceDefinition.
+var CRDGroupKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+// AnnotationOwner is the annotation key of the owner of a CRD. CRDs are
+// cluster-scoped and can't refer to namespaced owners, so the owner is recorded
+// as "<namespace>/<name>".
+const AnnotationOwner = "release.caicloud.io/owner"
+
+// IsCRD checks if gvk is CustomResourceDefinition. CRDs are shared by all
+// namespaces, and deleting a CRD deletes all its instances. So rudder never
+// sets owner references for CRDs and never deletes them implicitly.
+func IsCRD(gvk schema.GroupVersionKind) bool {
+	return gvk.GroupKind() == CRDGroupKind
+}
+
+// crdOwner returns the owner of CRDs applied with refs in namespace. It returns
+// an empty string if there is no owner.
+func crdOwner(namespace string, refs []metav1.OwnerReference) string {
+	if len(refs) <= 0 {
+		return ""
+	}
+	return namespace + "/" + refs[0].Name
+}
+
+// setCRDOwner records owner into the annotations of a CRD.
+func setCRDOwner(accessor metav1.Object, owner string) {
+	if owner == "" {
+		return
+	}
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AnnotationOwner] = owner
+	accessor.SetAnnotations(annotations)
+}
+
+// checkCRDOwner checks if obj can be applied to an existing CRD. A CRD can be
+// updated by its owner. A CRD of another owner is left as it is if obj doesn't
+// change its spec. Otherwise an error is returned. It returns false if the CRD
+// should not be updated.
+func checkCRDOwner(owner string, existence, obj runtime.Object) (bool, error) {
+	if owner == "" {
+		return true, nil
+	}
+	accessor, err := meta.Accessor(existence)
+	if err != nil {
+		return false, err
+	}
+	current := accessor.GetAnnotations()[AnnotationOwner]
+	if current == owner {
+		return true, nil
+	}
+	unchanged, err := crdSpecUnchanged(accessor, existence, obj)
+	if err != nil {
+		return false, err
+	}
+	if unchanged {
+		return false, nil
+	}
+	if current == "" {
+		return false, fmt.Errorf("CRD %s is not created by release %s and its spec can't be changed by it; "+
+			"set annotation %s=%s on the CRD to take it over", accessor.GetName(), owner, AnnotationOwner, owner)
+	}
+	return false, fmt.Errorf("CRD %s is owned by release %s and its spec can't be changed by release %s",
+		accessor.GetName(), current, owner)
+}
+
+// crdSpecUnchanged checks if the spec of obj is the same as the last applied
+// spec of existence. If existence has no last applied configuration, the spec
+// is unchanged if all fields of it are the same in existence.
+func crdSpecUnchanged(accessor metav1.Object, existence, obj runtime.Object) (bool, error) {
+	desired, err := specOf(obj)
+	if err != nil {
+		return false, err
+	}
+	if lastApplied := accessor.GetAnnotations()[AnnotationLastApplied]; lastApplied != "" {
+		content := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(lastApplied), &content); err != nil {
+			return false, err
+		}
+		return reflect.DeepEqual(desired, content["spec"]), nil
+	}
+	current, err := specOf(existence)
+	if err != nil {
+		return false, err
+	}
+	return contains(current, desired), nil
+}
+
+// specOf returns the spec of obj in json types.
+func specOf(obj runtime.Object) (interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]interface{}{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	return content["spec"], nil
+}
+
+// contains checks if all fields in sub are the same in value.
+func contains(value, sub interface{}) bool {
+	switch s := sub.(type) {
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, field := range s {
+			if !contains(v[key], field) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok || len(v) != len(s) {
+			return false
+		}
+		for i := range s {
+			if !contains(v[i], s[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(value, sub)
+	}
+}
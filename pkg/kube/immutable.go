@@ -0,0 +1,132 @@
+package kube
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// AnnotationImmutablePolicy is the annotation key of the policy for changes of
+// immutable fields of an object. The value is an ImmutablePolicy.
+const AnnotationImmutablePolicy = "release.caicloud.io/immutable-policy"
+
+// ImmutablePolicy decides how to handle changes of immutable fields.
+type ImmutablePolicy string
+
+const (
+	// ImmutablePolicyIgnore keeps current values of immutable fields and logs a
+	// warning. It's the default policy unless the change can only be done by
+	// recreation, such as switching a service to or from headless.
+	ImmutablePolicyIgnore ImmutablePolicy = "ignore"
+	// ImmutablePolicyRecreate deletes the object and its dependents, then
+	// creates the object again.
+	ImmutablePolicyRecreate ImmutablePolicy = "recreate"
+	// ImmutablePolicyOrphanRecreate deletes the object but orphans its
+	// dependents, then creates the object again. It's useful for StatefulSets
+	// whose pods should keep running.
+	ImmutablePolicyOrphanRecreate ImmutablePolicy = "orphan-recreate"
+)
+
+const (
+	// deletionTimeout is the max duration to wait for an object to be deleted
+	// before it's recreated.
+	deletionTimeout = 2 * time.Minute
+	// deletionInterval is the interval to check if an object is deleted.
+	deletionInterval = time.Second
+)
+
+// ImmutableDecision records how changes of immutable fields of an object are
+// handled.
+type ImmutableDecision struct {
+	// Kind is the kind of the object.
+	Kind string
+	// Name is the name of the object.
+	Name string
+	// Fields are paths of changed immutable fields.
+	Fields []string
+	// Policy is the policy applied to the object.
+	Policy ImmutablePolicy
+}
+
+// ImmutableRecorder receives decisions for changes of immutable fields.
+type ImmutableRecorder func(decision ImmutableDecision)
+
+// immutablePolicyFor gets the immutable policy of an object. If the object has
+// no policy, the default policy is ImmutablePolicyRecreate when recreate is true,
+// and ImmutablePolicyIgnore otherwise.
+func immutablePolicyFor(accessor metav1.Object, recreate bool) (ImmutablePolicy, error) {
+	policy := ImmutablePolicy(accessor.GetAnnotations()[AnnotationImmutablePolicy])
+	switch policy {
+	case "":
+		if recreate {
+			return ImmutablePolicyRecreate, nil
+		}
+		return ImmutablePolicyIgnore, nil
+	case ImmutablePolicyIgnore, ImmutablePolicyRecreate, ImmutablePolicyOrphanRecreate:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid immutable policy %q of %s", policy, accessor.GetName())
+	}
+}
+
+// recreate deletes an object by policy and creates it again.
+func (c *client) recreate(client *ResourceClient, gvk schema.GroupVersionKind, accessor metav1.Object, obj runtime.Object, policy ImmutablePolicy, options ApplyOptions, dryRun []string) error {
+	propagation := metav1.DeletePropagationBackground
+	if policy == ImmutablePolicyOrphanRecreate {
+		propagation = metav1.DeletePropagationOrphan
+	}
+	err := client.Delete(accessor.GetName(), &metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		DryRun:            dryRun,
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if len(dryRun) > 0 {
+		// The object would be re-created. Only check if it can be deleted.
+		return nil
+	}
+	if c.layers != nil {
+		// Record the result into cache.
+		layer, err := c.layers.LayerFor(gvk)
+		if err != nil {
+			return err
+		}
+		layer.Deleted(obj)
+	}
+	// Finalizers may delay the deletion.
+	err = wait.PollImmediate(deletionInterval, deletionTimeout, func() (bool, error) {
+		_, err := client.Get(accessor.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("can't wait for %s/%s(%s) to be deleted: %v", accessor.GetNamespace(), accessor.GetName(), gvk.Kind, err)
+	}
+	glog.Infof("Recreate %s/%s(%s) with policy %s", accessor.GetNamespace(), accessor.GetName(), gvk.Kind, policy)
+	if options.ServerSide {
+		return c.serverSideApply(client, gvk, accessor, obj, options, nil, false)
+	}
+	accessor.SetResourceVersion("")
+	result, err := client.Create(obj)
+	if err != nil {
+		return err
+	}
+	if c.layers != nil {
+		// Record the result into cache.
+		layer, err := c.layers.LayerFor(gvk)
+		if err != nil {
+			return err
+		}
+		layer.Created(result)
+	}
+	return nil
+}
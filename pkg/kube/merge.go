@@ -0,0 +1,129 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/caicloud/clientset/kubernetes/scheme"
+	jsonpatch "github.com/evanphx/json-patch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// AnnotationLastApplied is the annotation key of the last applied configuration
+// of an object. It works like the annotation of kubectl apply, but is owned by
+// rudder.
+const AnnotationLastApplied = "release.caicloud.io/last-applied-configuration"
+
+// setLastApplied records the configuration of obj into its annotations.
+func setLastApplied(accessor metav1.Object, obj runtime.Object) error {
+	annotations := accessor.GetAnnotations()
+	delete(annotations, AnnotationLastApplied)
+	accessor.SetAnnotations(annotations)
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AnnotationLastApplied] = string(data)
+	accessor.SetAnnotations(annotations)
+	return nil
+}
+
+// threeWayPatch creates a patch which changes current to modified. Fields
+// removed from original are deleted, and fields set by others in current are
+// kept. Kinds known by rudder use strategic merge patch, others use json merge
+// patch.
+func threeWayPatch(gvk schema.GroupVersionKind, original, modified, current []byte) (types.PatchType, []byte, error) {
+	versioned, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		if !runtime.IsNotRegisteredError(err) {
+			return "", nil, err
+		}
+		patch, err := threeWayJSONMergePatch(original, modified, current)
+		return types.MergePatchType, patch, err
+	}
+	meta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+	if err != nil {
+		return "", nil, err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, meta, true)
+	return types.StrategicMergePatchType, patch, err
+}
+
+// twoWayPatch creates a patch which changes original to modified. Kinds known by
+// rudder use strategic merge patch, others use json merge patch.
+func twoWayPatch(gvk schema.GroupVersionKind, original, modified []byte) (types.PatchType, []byte, error) {
+	versioned, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		if !runtime.IsNotRegisteredError(err) {
+			return "", nil, err
+		}
+		patch, err := jsonpatch.CreateMergePatch(original, modified)
+		return types.MergePatchType, patch, err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(original, modified, versioned)
+	return types.StrategicMergePatchType, patch, err
+}
+
+// threeWayJSONMergePatch creates a json merge patch like strategic merge patch.
+// Additions and changes come from the diff of current and modified, and
+// deletions come from the diff of original and modified.
+func threeWayJSONMergePatch(original, modified, current []byte) ([]byte, error) {
+	addAndChange, err := jsonpatch.CreateMergePatch(current, modified)
+	if err != nil {
+		return nil, err
+	}
+	addAndChange, err = filterNulls(addAndChange, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(original) <= 0 {
+		return addAndChange, nil
+	}
+	deletion, err := jsonpatch.CreateMergePatch(original, modified)
+	if err != nil {
+		return nil, err
+	}
+	deletion, err = filterNulls(deletion, true)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.MergeMergePatches(deletion, addAndChange)
+}
+
+// filterNulls keeps only null fields of a merge patch if nulls is true, or
+// removes all null fields if nulls is false.
+func filterNulls(patch []byte, nulls bool) ([]byte, error) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(patch, &m); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %v", err)
+	}
+	return json.Marshal(filterMap(m, nulls))
+}
+
+func filterMap(m map[string]interface{}, nulls bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range m {
+		switch value := v.(type) {
+		case nil:
+			if nulls {
+				result[k] = nil
+			}
+		case map[string]interface{}:
+			if sub := filterMap(value, nulls); len(sub) > 0 || (!nulls && len(value) == 0) {
+				result[k] = sub
+			}
+		default:
+			if !nulls {
+				result[k] = v
+			}
+		}
+	}
+	return result
+}
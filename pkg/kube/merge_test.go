@@ -0,0 +1,259 @@
+package kube
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/caicloud/clientset/kubernetes/scheme"
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+func TestThreeWayPatch(t *testing.T) {
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	crontab := schema.GroupVersionKind{Group: "stable.example.com", Version: "v1", Kind: "CronTab"}
+	testCases := []struct {
+		name      string
+		gvk       schema.GroupVersionKind
+		original  string
+		modified  string
+		current   string
+		patchType types.PatchType
+		// expected is current after patched.
+		expected string
+	}{
+		{
+			"field deleted from last-applied",
+			deployment,
+			`{"metadata":{"name":"web","labels":{"app":"web","env":"dev"}}}`,
+			`{"metadata":{"name":"web","labels":{"app":"web"}}}`,
+			`{"metadata":{"name":"web","labels":{"app":"web","env":"dev"}}}`,
+			types.StrategicMergePatchType,
+			`{"metadata":{"name":"web","labels":{"app":"web"}}}`,
+		},
+		{
+			"replicas set by HPA",
+			deployment,
+			`{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v1"}]}}}}`,
+			`{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v2"}]}}}}`,
+			`{"spec":{"replicas":5,"template":{"spec":{"containers":[{"name":"web","image":"web:v1"}]}}}}`,
+			types.StrategicMergePatchType,
+			`{"spec":{"replicas":5,"template":{"spec":{"containers":[{"name":"web","image":"web:v2"}]}}}}`,
+		},
+		{
+			"injected sidecar",
+			deployment,
+			`{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v1"}]}}}}`,
+			`{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v2"}]}}}}`,
+			`{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v1"},{"name":"proxy","image":"proxy:v1"}]}}}}`,
+			types.StrategicMergePatchType,
+			`{"spec":{"template":{"spec":{"containers":[{"name":"web","image":"web:v2"},{"name":"proxy","image":"proxy:v1"}]}}}}`,
+		},
+		{
+			"CRD field deleted from last-applied",
+			crontab,
+			`{"spec":{"image":"backup:v1","replicas":1}}`,
+			`{"spec":{"image":"backup:v2"}}`,
+			`{"spec":{"image":"backup:v1","replicas":1,"suspend":true}}`,
+			types.MergePatchType,
+			`{"spec":{"image":"backup:v2","suspend":true}}`,
+		},
+		{
+			"CRD without last-applied",
+			crontab,
+			``,
+			`{"spec":{"image":"backup:v2"}}`,
+			`{"spec":{"image":"backup:v1","replicas":1}}`,
+			types.MergePatchType,
+			`{"spec":{"image":"backup:v2","replicas":1}}`,
+		},
+		{
+			"CRD list replaced",
+			crontab,
+			`{"spec":{"args":["a","b"]}}`,
+			`{"spec":{"args":["a"]}}`,
+			`{"spec":{"args":["a","b"],"suspend":true}}`,
+			types.MergePatchType,
+			`{"spec":{"args":["a"],"suspend":true}}`,
+		},
+		{
+			"CRD empty nested map added",
+			crontab,
+			`{"spec":{"image":"backup:v1"}}`,
+			`{"spec":{"image":"backup:v1","selector":{}}}`,
+			`{"spec":{"image":"backup:v1"}}`,
+			types.MergePatchType,
+			`{"spec":{"image":"backup:v1","selector":{}}}`,
+		},
+		{
+			"CRD nested map emptied",
+			crontab,
+			`{"spec":{"config":{"a":"1"}}}`,
+			`{"spec":{"config":{}}}`,
+			`{"spec":{"config":{"a":"1","b":"2"}}}`,
+			types.MergePatchType,
+			`{"spec":{"config":{"b":"2"}}}`,
+		},
+	}
+	for _, tc := range testCases {
+		patchType, patch, err := threeWayPatch(tc.gvk, []byte(tc.original), []byte(tc.modified), []byte(tc.current))
+		if err != nil {
+			t.Errorf("%s: can't create patch: %v", tc.name, err)
+			continue
+		}
+		if patchType != tc.patchType {
+			t.Errorf("%s: expected patch type %s but got %s", tc.name, tc.patchType, patchType)
+			continue
+		}
+		var result []byte
+		switch patchType {
+		case types.StrategicMergePatchType:
+			versioned, err := scheme.Scheme.New(tc.gvk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err = strategicpatch.StrategicMergePatch([]byte(tc.current), patch, versioned)
+			if err != nil {
+				t.Errorf("%s: can't apply patch %s: %v", tc.name, patch, err)
+				continue
+			}
+		case types.MergePatchType:
+			result, err = jsonpatch.MergePatch([]byte(tc.current), patch)
+			if err != nil {
+				t.Errorf("%s: can't apply patch %s: %v", tc.name, patch, err)
+				continue
+			}
+		}
+		var got, expected interface{}
+		if err := json.Unmarshal(result, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tc.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: patch %s results in %s but expected %s", tc.name, patch, result, tc.expected)
+		}
+	}
+}
+
+func TestThreeWayJSONMergePatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		original string
+		modified string
+		current  string
+		expected string
+	}{
+		{
+			"no change",
+			`{"a":"1"}`,
+			`{"a":"1"}`,
+			`{"a":"1","b":"2"}`,
+			`{}`,
+		},
+		{
+			"change",
+			`{"a":"1"}`,
+			`{"a":"2"}`,
+			`{"a":"1","b":"2"}`,
+			`{"a":"2"}`,
+		},
+		{
+			"deletion",
+			`{"a":"1","c":{"d":"1"}}`,
+			`{"a":"1"}`,
+			`{"a":"1","b":"2","c":{"d":"1"}}`,
+			`{"c":null}`,
+		},
+		{
+			"nested deletion",
+			`{"c":{"d":"1","e":"1"}}`,
+			`{"c":{"d":"1"}}`,
+			`{"c":{"d":"1","e":"1","f":"1"}}`,
+			`{"c":{"e":null}}`,
+		},
+		{
+			"empty nested map",
+			`{"a":"1"}`,
+			`{"a":"1","c":{}}`,
+			`{"a":"1"}`,
+			`{"c":{}}`,
+		},
+		{
+			"no original",
+			``,
+			`{"a":"2"}`,
+			`{"a":"1","b":"2"}`,
+			`{"a":"2"}`,
+		},
+	}
+	for _, tc := range testCases {
+		patch, err := threeWayJSONMergePatch([]byte(tc.original), []byte(tc.modified), []byte(tc.current))
+		if err != nil {
+			t.Errorf("%s: can't create patch: %v", tc.name, err)
+			continue
+		}
+		var got, expected interface{}
+		if err := json.Unmarshal(patch, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tc.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: got patch %s but expected %s", tc.name, patch, tc.expected)
+		}
+	}
+}
+
+func TestFilterMap(t *testing.T) {
+	input := map[string]interface{}{
+		"a": "1",
+		"b": nil,
+		"c": map[string]interface{}{
+			"d": "1",
+			"e": nil,
+		},
+		"f": map[string]interface{}{
+			"g": nil,
+		},
+		"h": map[string]interface{}{
+			"i": "1",
+		},
+		"j": map[string]interface{}{},
+	}
+	testCases := []struct {
+		name     string
+		nulls    bool
+		expected map[string]interface{}
+	}{
+		{
+			"nulls",
+			true,
+			map[string]interface{}{
+				"b": nil,
+				"c": map[string]interface{}{"e": nil},
+				"f": map[string]interface{}{"g": nil},
+			},
+		},
+		{
+			"values",
+			false,
+			map[string]interface{}{
+				"a": "1",
+				"c": map[string]interface{}{"d": "1"},
+				"h": map[string]interface{}{"i": "1"},
+				"j": map[string]interface{}{},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		if got := filterMap(input, tc.nulls); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: got %v but expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
@@ -53,6 +53,35 @@ type ApplyOptions struct {
 	OwnerReferences []metav1.OwnerReference
 	// OwnerChecker checks
 	Checker OwnerChecker
+	// DryRun sends all requests with dryRun=All. Nothing is persisted and
+	// cache layers are not changed.
+	DryRun bool
+	// ServerSide applies objects with server-side apply instead of three-way
+	// merge patches. FieldManager must be set.
+	ServerSide bool
+	// FieldManager is the manager name of fields applied by server-side apply.
+	FieldManager string
+	// Force takes ownership of fields which conflict with other managers in
+	// server-side apply. Otherwise a *ConflictError is returned.
+	Force bool
+	// Recorder receives decisions for changes of immutable fields. The policy
+	// of an object is set by AnnotationImmutablePolicy.
+	Recorder ImmutableRecorder
+}
+
+// DryRunResult is the result of a resource in dry-run.
+type DryRunResult struct {
+	// Kind is the kind of the resource.
+	Kind string `json:"kind"`
+	// Name is the name of the resource.
+	Name string `json:"name"`
+	// Accepted is true if the api server accepted the resource.
+	Accepted bool `json:"accepted"`
+	// Skipped is true if the resource can't be dry-run. For example, instances
+	// of CRDs which are not created yet.
+	Skipped bool `json:"skipped,omitempty"`
+	// Reason is the reason why the resource was rejected.
+	Reason string `json:"reason,omitempty"`
 }
 
 // DeleteOptions is a  group options for deleting resources
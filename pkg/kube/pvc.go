@@ -0,0 +1,91 @@
+package kube
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ShrinkError is returned when the storage request of a PVC is decreased.
+// Volumes can't be shrunk.
+type ShrinkError struct {
+	// Name is the name of the PVC.
+	Name string
+	// Current is the current storage request.
+	Current string
+	// Desired is the desired storage request.
+	Desired string
+}
+
+func (e *ShrinkError) Error() string {
+	return fmt.Sprintf("PersistentVolumeClaim %s can't be shrunk from %s to %s", e.Name, e.Current, e.Desired)
+}
+
+// checkPVCExpansion checks the change of storage request of a PVC. A decrease
+// is rejected with a *ShrinkError. An increase is kept only if the storage
+// class of the PVC allows volume expansion. Otherwise the current request is
+// restored and the decision is recorded as an ignored immutable change.
+func (c *client) checkPVCExpansion(namespace string, existence, obj runtime.Object, options ApplyOptions) error {
+	current, ok := existence.(*core.PersistentVolumeClaim)
+	if !ok {
+		return nil
+	}
+	desired, ok := obj.(*core.PersistentVolumeClaim)
+	if !ok {
+		return nil
+	}
+	desiredSize, ok := desired.Spec.Resources.Requests[core.ResourceStorage]
+	if !ok {
+		return nil
+	}
+	currentSize := current.Spec.Resources.Requests[core.ResourceStorage]
+	switch desiredSize.Cmp(currentSize) {
+	case 0:
+		return nil
+	case -1:
+		return &ShrinkError{
+			Name:    desired.Name,
+			Current: currentSize.String(),
+			Desired: desiredSize.String(),
+		}
+	}
+	expandable, err := c.expandable(current)
+	if err != nil {
+		return err
+	}
+	if expandable {
+		glog.Infof("Expand PersistentVolumeClaim %s/%s from %s to %s", namespace, desired.Name, currentSize.String(), desiredSize.String())
+		return nil
+	}
+	glog.Warningf("Storage class of PersistentVolumeClaim %s/%s doesn't allow volume expansion, ignore the new size %s",
+		namespace, desired.Name, desiredSize.String())
+	desired.Spec.Resources.Requests[core.ResourceStorage] = currentSize
+	if options.Recorder != nil {
+		options.Recorder(ImmutableDecision{
+			Kind:   "PersistentVolumeClaim",
+			Name:   desired.Name,
+			Fields: []string{"spec.resources.requests.storage"},
+			Policy: ImmutablePolicyIgnore,
+		})
+	}
+	return nil
+}
+
+// expandable checks if the storage class of a PVC allows volume expansion.
+func (c *client) expandable(pvc *core.PersistentVolumeClaim) (bool, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return false, nil
+	}
+	obj, err := c.getObject(storagev1.SchemeGroupVersion.WithKind("StorageClass"), "", *pvc.Spec.StorageClassName)
+	if err != nil {
+		return false, err
+	}
+	class, ok := obj.(*storagev1.StorageClass)
+	if !ok {
+		return false, fmt.Errorf("unrecognized storage class %s", *pvc.Spec.StorageClassName)
+	}
+	return class.AllowVolumeExpansion != nil && *class.AllowVolumeExpansion, nil
+}
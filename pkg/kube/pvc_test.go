@@ -0,0 +1,81 @@
+package kube
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pvcWithStorage creates a PVC with a storage request. The request is not set
+// if storage is empty.
+func pvcWithStorage(storage string) *core.PersistentVolumeClaim {
+	pvc := &core.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data"}}
+	if storage != "" {
+		pvc.Spec.Resources.Requests = core.ResourceList{core.ResourceStorage: resource.MustParse(storage)}
+	}
+	return pvc
+}
+
+func TestCheckPVCExpansion(t *testing.T) {
+	testCases := []struct {
+		name    string
+		current string
+		desired string
+		// expected is the storage request of desired after checked.
+		expected  string
+		decisions []ImmutableDecision
+		err       string
+	}{
+		{"same storage", "1Gi", "1Gi", "1Gi", nil, ""},
+		{"same storage in different units", "1Gi", "1024Mi", "1024Mi", nil, ""},
+		{"no storage request", "1Gi", "", "", nil, ""},
+		{
+			"shrink",
+			"2Gi",
+			"1Gi",
+			"1Gi",
+			nil,
+			"PersistentVolumeClaim data can't be shrunk from 2Gi to 1Gi",
+		},
+		{
+			"expansion without storage class",
+			"1Gi",
+			"2Gi",
+			"1Gi",
+			[]ImmutableDecision{{
+				Kind:   "PersistentVolumeClaim",
+				Name:   "data",
+				Fields: []string{"spec.resources.requests.storage"},
+				Policy: ImmutablePolicyIgnore,
+			}},
+			"",
+		},
+	}
+	for _, tc := range testCases {
+		desired := pvcWithStorage(tc.desired)
+		decisions := []ImmutableDecision{}
+		options := ApplyOptions{Recorder: func(decision ImmutableDecision) {
+			decisions = append(decisions, decision)
+		}}
+		err := (&client{}).checkPVCExpansion("default", pvcWithStorage(tc.current), desired, options)
+		if tc.err != "" {
+			if _, ok := err.(*ShrinkError); !ok || err.Error() != tc.err {
+				t.Errorf("%s: expected error %q but got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if expected := pvcWithStorage(tc.expected); !reflect.DeepEqual(desired.Spec, expected.Spec) {
+			t.Errorf("%s: got %+v but expected %+v", tc.name, desired.Spec, expected.Spec)
+		}
+		if len(decisions) != len(tc.decisions) || (len(decisions) > 0 && !reflect.DeepEqual(decisions, tc.decisions)) {
+			t.Errorf("%s: got decisions %+v but expected %+v", tc.name, decisions, tc.decisions)
+		}
+	}
+}
@@ -3,10 +3,14 @@ package kube
 import (
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/caicloud/clientset/kubernetes"
+	"github.com/golang/glog"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/rest"
 )
 
@@ -16,6 +20,14 @@ type APIResources interface {
 	ResourceFor(gvk schema.GroupVersionKind) (*Resource, error)
 	// Resources gets all api resources.
 	Resources() map[schema.GroupVersionKind]*Resource
+	// ServerVersion gets the version of api server.
+	ServerVersion() *version.Info
+	// Refresh discovers api resources from api server again. Handlers registered
+	// by OnRemove are called for kinds which are removed.
+	Refresh() error
+	// OnRemove registers a handler which is called when a kind is removed from
+	// api server.
+	OnRemove(handler func(gvk schema.GroupVersionKind))
 }
 
 // Resource is API resource
@@ -48,9 +60,20 @@ func (r *Resource) GroupVersionResource() schema.GroupVersionResource {
 	}
 }
 
+// minRefreshInterval is the min interval between two refreshes caused by
+// missing kinds.
+const minRefreshInterval = 5 * time.Second
+
 // apiResources contains all api resources.
 type apiResources struct {
-	resources map[schema.GroupVersionKind]*Resource
+	// refreshLock serializes refreshes.
+	refreshLock sync.Mutex
+	lock        sync.RWMutex
+	client      kubernetes.Interface
+	resources   map[schema.GroupVersionKind]*Resource
+	version     *version.Info
+	refreshedAt time.Time
+	handlers    []func(gvk schema.GroupVersionKind)
 }
 
 // NewAPIResourcesByConfig creates APIResources by kube config.
@@ -66,28 +89,41 @@ func NewAPIResourcesByConfig(config *rest.Config) (APIResources, error) {
 
 // NewAPIResources creates APIResources by kube client.
 func NewAPIResources(client kubernetes.Interface) (APIResources, error) {
-	_, resources, err := client.Discovery().ServerGroupsAndResources()
-	if err != nil {
+	apiResources := &apiResources{
+		client: client,
+	}
+	if err := apiResources.Refresh(); err != nil {
 		return nil, err
 	}
+	return apiResources, nil
+}
 
-	apiResources := &apiResources{
-		resources: make(map[schema.GroupVersionKind]*Resource),
+// discover gets all api resources and the version of api server.
+func discover(client kubernetes.Interface) (map[schema.GroupVersionKind]*Resource, *version.Info, error) {
+	_, resources, err := client.Discovery().ServerGroupsAndResources()
+	if err != nil {
+		return nil, nil, err
 	}
+	info, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := make(map[schema.GroupVersionKind]*Resource)
 	for _, list := range resources {
 		gv, err := schema.ParseGroupVersion(list.GroupVersion)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		for _, resource := range list.APIResources {
 			gvk := gv.WithKind(resource.Kind)
-			res, ok := apiResources.resources[gvk]
+			res, ok := result[gvk]
 			if !strings.Contains(resource.Name, "/") {
 				// Root resource
 				if ok {
 					res.APIResource = resource
 				} else {
-					apiResources.resources[gvk] = &Resource{
+					result[gvk] = &Resource{
 						APIResource: resource,
 						Group:       gv.Group,
 						Version:     gv.Version,
@@ -100,7 +136,7 @@ func NewAPIResources(client kubernetes.Interface) (APIResources, error) {
 						Group:   gv.Group,
 						Version: gv.Version,
 					}
-					apiResources.resources[gvk] = res
+					result[gvk] = res
 				}
 				res.Subresources = append(res.Subresources, &Resource{
 					APIResource: resource,
@@ -110,19 +146,141 @@ func NewAPIResources(client kubernetes.Interface) (APIResources, error) {
 			}
 		}
 	}
-	return apiResources, nil
+	return result, info, nil
+}
+
+// Refresh discovers api resources from api server again.
+func (ar *apiResources) Refresh() error {
+	ar.refreshLock.Lock()
+	defer ar.refreshLock.Unlock()
+	return ar.refresh()
+}
+
+// refreshSince refreshes api resources if they are not refreshed after since.
+// Concurrent misses of a new kind only cause one refresh.
+func (ar *apiResources) refreshSince(since time.Time) error {
+	ar.refreshLock.Lock()
+	defer ar.refreshLock.Unlock()
+	ar.lock.RLock()
+	refreshed := ar.refreshedAt.After(since)
+	ar.lock.RUnlock()
+	if refreshed {
+		return nil
+	}
+	return ar.refresh()
+}
+
+func (ar *apiResources) refresh() error {
+	resources, info, err := discover(ar.client)
+	if err != nil {
+		return err
+	}
+	ar.lock.Lock()
+	removed := make([]schema.GroupVersionKind, 0)
+	for gvk := range ar.resources {
+		if _, ok := resources[gvk]; !ok {
+			removed = append(removed, gvk)
+		}
+	}
+	ar.resources = resources
+	ar.version = info
+	ar.refreshedAt = time.Now()
+	handlers := ar.handlers
+	ar.lock.Unlock()
+
+	for _, gvk := range removed {
+		glog.V(2).Infof("API resource for %s is removed", gvk)
+		for _, handler := range handlers {
+			handler(gvk)
+		}
+	}
+	return nil
+}
+
+// OnRemove registers a handler which is called when a kind is removed.
+func (ar *apiResources) OnRemove(handler func(gvk schema.GroupVersionKind)) {
+	ar.lock.Lock()
+	defer ar.lock.Unlock()
+	ar.handlers = append(ar.handlers, handler)
+}
+
+func (ar *apiResources) resourceFor(gvk schema.GroupVersionKind) (*Resource, time.Time, bool) {
+	ar.lock.RLock()
+	defer ar.lock.RUnlock()
+	resource, ok := ar.resources[gvk]
+	return resource, ar.refreshedAt, ok
 }
 
 // ResourceFor gets api resource by GroupVersionKind
+// If the kind is not found, api resources are refreshed and checked again. It's
+// useful when a CRD is created after rudder starts.
 func (ar *apiResources) ResourceFor(gvk schema.GroupVersionKind) (*Resource, error) {
-	resource, ok := ar.resources[gvk]
-	if !ok {
-		return nil, fmt.Errorf("can't find api resource for: %s", gvk)
+	resource, refreshedAt, ok := ar.resourceFor(gvk)
+	if ok {
+		return resource, nil
+	}
+	if time.Since(refreshedAt) >= minRefreshInterval {
+		if err := ar.refreshSince(refreshedAt); err != nil {
+			glog.Errorf("Can't refresh api resources for %s: %v", gvk, err)
+		} else if resource, _, ok = ar.resourceFor(gvk); ok {
+			return resource, nil
+		}
 	}
-	return resource, nil
+	return nil, fmt.Errorf("can't find api resource for: %s", gvk)
 }
 
 // Resources gets all api resources.
 func (ar *apiResources) Resources() map[schema.GroupVersionKind]*Resource {
+	ar.lock.RLock()
+	defer ar.lock.RUnlock()
 	return ar.resources
 }
+
+// ServerVersion gets the version of api server.
+func (ar *apiResources) ServerVersion() *version.Info {
+	ar.lock.RLock()
+	defer ar.lock.RUnlock()
+	return ar.version
+}
+
+// Refresher refreshes api resources periodically and on demand.
+type Refresher struct {
+	resources APIResources
+	period    time.Duration
+	trigger   chan struct{}
+}
+
+// NewRefresher creates a refresher for resources.
+func NewRefresher(resources APIResources, period time.Duration) *Refresher {
+	return &Refresher{
+		resources: resources,
+		period:    period,
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// Trigger asks the refresher to refresh api resources as soon as possible.
+// Triggers are merged if the refresher is busy.
+func (r *Refresher) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run refreshes api resources until stopCh is closed.
+func (r *Refresher) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
+		if err := r.resources.Refresh(); err != nil {
+			glog.Errorf("Can't refresh api resources: %v", err)
+		}
+	}
+}
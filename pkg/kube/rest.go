@@ -5,10 +5,13 @@ import (
 	"sync"
 
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/rest"
@@ -22,6 +25,19 @@ type ClientPool interface {
 	ClientFor(gvk schema.GroupVersionKind, namespace string) (*ResourceClient, error)
 }
 
+// unstructuredSerializer encodes and decodes objects as *unstructured.Unstructured.
+var unstructuredSerializer = serializer.NegotiatedSerializerWrapper(runtime.SerializerInfo{
+	MediaType:        runtime.ContentTypeJSON,
+	EncodesAsText:    true,
+	Serializer:       unstructured.UnstructuredJSONScheme,
+	PrettySerializer: unstructured.UnstructuredJSONScheme,
+	StreamSerializer: &runtime.StreamSerializerInfo{
+		EncodesAsText: true,
+		Serializer:    unstructured.UnstructuredJSONScheme,
+		Framer:        json.Framer,
+	},
+})
+
 // clientPool describes a client pool for object scheme.
 type clientPool struct {
 	sync.Mutex
@@ -44,9 +60,17 @@ func NewClientPool(scheme *runtime.Scheme, config *rest.Config, resources APIRes
 		resources: resources,
 		clients:   make(map[schema.GroupVersionKind]*ResourceClient),
 	}
+	resources.OnRemove(pool.invalidate)
 	return pool, nil
 }
 
+// invalidate removes the client of a kind which is removed from api server.
+func (cp *clientPool) invalidate(gvk schema.GroupVersionKind) {
+	cp.Lock()
+	defer cp.Unlock()
+	delete(cp.clients, gvk)
+}
+
 // ClientFor gets a client for specified kind of an object. If APIResource of the kind is
 // non-namespaced, ignore the namespace. If the resource is namespaced and namespace is empty,
 // It uses 'Default' as the namespace.
@@ -72,7 +96,16 @@ func (cp *clientPool) ClientFor(gvk schema.GroupVersionKind, namespace string) (
 		}
 		gv := gvk.GroupVersion()
 		conf.GroupVersion = &gv
-		conf.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: cp.factory}
+		parameterCodec := cp.codec
+		if cp.scheme.Recognizes(gvk) {
+			conf.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: cp.factory}
+		} else {
+			// Kinds unknown by the scheme are sent and received as unstructured objects.
+			conf.ContentType = runtime.ContentTypeJSON
+			conf.AcceptContentTypes = runtime.ContentTypeJSON
+			conf.NegotiatedSerializer = unstructuredSerializer
+			parameterCodec = metav1.ParameterCodec
+		}
 		cl, err := rest.RESTClientFor(&conf)
 		if err != nil {
 			return nil, err
@@ -80,7 +113,7 @@ func (cp *clientPool) ClientFor(gvk schema.GroupVersionKind, namespace string) (
 		client = &ResourceClient{
 			cl:             cl,
 			resource:       &resource.APIResource,
-			parameterCodec: cp.codec,
+			parameterCodec: parameterCodec,
 		}
 		cp.clients[gvk] = client
 	}
@@ -102,6 +135,14 @@ type ResourceClient struct {
 	parameterCodec runtime.ParameterCodec
 }
 
+// AllNamespaces returns a copy of the client which lists and watches objects
+// across all namespaces.
+func (rc *ResourceClient) AllNamespaces() *ResourceClient {
+	copy := *rc
+	copy.ns = metav1.NamespaceAll
+	return &copy
+}
+
 // List returns a list of objects for this resource.
 func (rc *ResourceClient) List(opts metav1.ListOptions) (runtime.Object, error) {
 	return rc.cl.Get().
@@ -147,9 +188,15 @@ func (rc *ResourceClient) DeleteCollection(deleteOptions *metav1.DeleteOptions,
 
 // Create creates the provided resource.
 func (rc *ResourceClient) Create(obj runtime.Object) (runtime.Object, error) {
+	return rc.CreateWithOptions(obj, metav1.CreateOptions{})
+}
+
+// CreateWithOptions creates the provided resource with options.
+func (rc *ResourceClient) CreateWithOptions(obj runtime.Object, opts metav1.CreateOptions) (runtime.Object, error) {
 	return rc.cl.Post().
 		NamespaceIfScoped(rc.ns, rc.resource.Namespaced).
 		Resource(rc.resource.Name).
+		VersionedParams(&opts, metav1.ParameterCodec).
 		Body(obj).
 		Do().
 		Get()
@@ -157,11 +204,16 @@ func (rc *ResourceClient) Create(obj runtime.Object) (runtime.Object, error) {
 
 // Update updates the provided resource.
 func (rc *ResourceClient) Update(obj runtime.Object) (runtime.Object, error) {
-	accessor, ok := obj.(metav1.ObjectMetaAccessor)
-	if !ok {
+	return rc.UpdateWithOptions(obj, metav1.UpdateOptions{})
+}
+
+// UpdateWithOptions updates the provided resource with options.
+func (rc *ResourceClient) UpdateWithOptions(obj runtime.Object, opts metav1.UpdateOptions) (runtime.Object, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
 		return obj, fmt.Errorf("unrecognized object")
 	}
-	name := accessor.GetObjectMeta().GetName()
+	name := accessor.GetName()
 
 	if len(name) == 0 {
 		return obj, fmt.Errorf("object missing name")
@@ -170,6 +222,7 @@ func (rc *ResourceClient) Update(obj runtime.Object) (runtime.Object, error) {
 		NamespaceIfScoped(rc.ns, rc.resource.Namespaced).
 		Resource(rc.resource.Name).
 		Name(name).
+		VersionedParams(&opts, metav1.ParameterCodec).
 		Body(obj).
 		Do().
 		Get()
@@ -187,10 +240,16 @@ func (rc *ResourceClient) Watch(opts metav1.ListOptions) (watch.Interface, error
 
 // Patch patches the provided resource.
 func (rc *ResourceClient) Patch(name string, pt types.PatchType, data []byte) (runtime.Object, error) {
+	return rc.PatchWithOptions(name, pt, data, metav1.PatchOptions{})
+}
+
+// PatchWithOptions patches the provided resource with options.
+func (rc *ResourceClient) PatchWithOptions(name string, pt types.PatchType, data []byte, opts metav1.PatchOptions) (runtime.Object, error) {
 	return rc.cl.Patch(pt).
 		NamespaceIfScoped(rc.ns, rc.resource.Namespaced).
 		Resource(rc.resource.Name).
 		Name(name).
+		VersionedParams(&opts, metav1.ParameterCodec).
 		Body(data).
 		Do().
 		Get()
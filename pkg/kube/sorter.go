@@ -1,90 +1,205 @@
 package kube
 
 import (
-	"math"
 	"sort"
+	"sync"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-type SortOrder map[string]int8
+// SortOrder is an order of kinds. Kinds in one rank are equal.
+type SortOrder struct {
+	// ranks contains built-in kinds.
+	ranks [][]schema.GroupKind
+	// reversed is true if registered kinds and unknown kinds are sorted before
+	// built-in kinds in reversed order.
+	reversed bool
+}
 
-// InstallOrder is the order in which manifests should be installed (by Kind).
+// InstallOrder is the order in which manifests should be installed (by GroupKind).
 //
 // Those occurring earlier in the list get installed before those occurring later in the list.
-var InstallOrder = orderBy([]string{
-	"Namespace",
-	"ResourceQuota",
-	"LimitRange",
-	"Secret",
-	"ConfigMap",
-	"PersistentVolume",
-	"PersistentVolumeClaim",
-	"ServiceAccount",
-	"ClusterRole",
-	"ClusterRoleBinding",
-	"Role",
-	"RoleBinding",
-	"Service",
-	"DaemonSet",
-	"Pod",
-	"ReplicationController",
-	"ReplicaSet",
-	"Deployment",
-	"StatefulSet",
-	"Job",
-	"CronJob",
-	"Ingress",
-})
+// CRDs are installed first. Kinds registered by RegisterKinds are installed after built-in
+// kinds, and unknown kinds (such as instances of CRDs) are installed at last.
+var InstallOrder = &SortOrder{
+	ranks: [][]schema.GroupKind{
+		kinds("CustomResourceDefinition", "apiextensions.k8s.io"),
+		kinds("Namespace", ""),
+		kinds("NetworkPolicy", "networking.k8s.io", "extensions"),
+		kinds("ResourceQuota", ""),
+		kinds("LimitRange", ""),
+		kinds("PodSecurityPolicy", "policy", "extensions"),
+		kinds("PodDisruptionBudget", "policy"),
+		kinds("Secret", ""),
+		kinds("ConfigMap", ""),
+		kinds("StorageClass", "storage.k8s.io"),
+		kinds("PersistentVolume", ""),
+		kinds("PersistentVolumeClaim", ""),
+		kinds("ServiceAccount", ""),
+		kinds("ClusterRole", "rbac.authorization.k8s.io"),
+		kinds("ClusterRoleBinding", "rbac.authorization.k8s.io"),
+		kinds("Role", "rbac.authorization.k8s.io"),
+		kinds("RoleBinding", "rbac.authorization.k8s.io"),
+		kinds("Service", ""),
+		kinds("DaemonSet", "apps", "extensions"),
+		kinds("Pod", ""),
+		kinds("ReplicationController", ""),
+		kinds("ReplicaSet", "apps", "extensions"),
+		kinds("Deployment", "apps", "extensions"),
+		kinds("HorizontalPodAutoscaler", "autoscaling"),
+		kinds("StatefulSet", "apps"),
+		kinds("Job", "batch"),
+		kinds("CronJob", "batch"),
+		kinds("Ingress", "networking.k8s.io", "extensions"),
+	},
+}
 
-// UninstallOrder is the order in which manifests should be uninstalled (by Kind).
+// UninstallOrder is the order in which manifests should be uninstalled (by GroupKind).
 //
 // Those occurring earlier in the list get uninstalled before those occurring later in the list.
-var UninstallOrder = orderBy([]string{
-	"Ingress",
-	"Service",
-	"CronJob",
-	"Job",
-	"StatefulSet",
-	"Deployment",
-	"ReplicaSet",
-	"ReplicationController",
-	"Pod",
-	"DaemonSet",
-	"RoleBinding",
-	"Role",
-	"ClusterRoleBinding",
-	"ClusterRole",
-	"ServiceAccount",
-	"PersistentVolumeClaim",
-	"PersistentVolume",
-	"ConfigMap",
-	"Secret",
-	"LimitRange",
-	"ResourceQuota",
-	"Namespace",
-})
+// Unknown kinds are uninstalled first, then kinds registered by RegisterKinds in reversed
+// order. CRDs are uninstalled at last.
+var UninstallOrder = &SortOrder{
+	ranks: [][]schema.GroupKind{
+		kinds("Ingress", "networking.k8s.io", "extensions"),
+		kinds("Service", ""),
+		kinds("HorizontalPodAutoscaler", "autoscaling"),
+		kinds("CronJob", "batch"),
+		kinds("Job", "batch"),
+		kinds("StatefulSet", "apps"),
+		kinds("Deployment", "apps", "extensions"),
+		kinds("ReplicaSet", "apps", "extensions"),
+		kinds("ReplicationController", ""),
+		kinds("Pod", ""),
+		kinds("DaemonSet", "apps", "extensions"),
+		kinds("RoleBinding", "rbac.authorization.k8s.io"),
+		kinds("Role", "rbac.authorization.k8s.io"),
+		kinds("ClusterRoleBinding", "rbac.authorization.k8s.io"),
+		kinds("ClusterRole", "rbac.authorization.k8s.io"),
+		kinds("ServiceAccount", ""),
+		kinds("PersistentVolumeClaim", ""),
+		kinds("PersistentVolume", ""),
+		kinds("StorageClass", "storage.k8s.io"),
+		kinds("ConfigMap", ""),
+		kinds("Secret", ""),
+		kinds("PodDisruptionBudget", "policy"),
+		kinds("PodSecurityPolicy", "policy", "extensions"),
+		kinds("LimitRange", ""),
+		kinds("ResourceQuota", ""),
+		kinds("NetworkPolicy", "networking.k8s.io", "extensions"),
+		kinds("Namespace", ""),
+		kinds("CustomResourceDefinition", "apiextensions.k8s.io"),
+	},
+	reversed: true,
+}
+
+var (
+	registryLock sync.RWMutex
+	// registeredKinds contains kinds which are registered by RegisterKinds.
+	registeredKinds []schema.GroupKind
+)
 
-// orderBy create a SortOrder for kinds.
-func orderBy(kinds []string) SortOrder {
-	order := make(SortOrder, len(kinds))
-	for i, k := range kinds {
-		order[k] = int8(i)
+// RegisterKinds registers kinds into InstallOrder and UninstallOrder. These kinds
+// are installed after built-in kinds in the specified order, and uninstalled before
+// built-in kinds in reversed order. Built-in kinds and registered kinds are ignored.
+func RegisterKinds(gks ...schema.GroupKind) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, gk := range gks {
+		if InstallOrder.builtin(gk) >= 0 || registered(gk) >= 0 {
+			continue
+		}
+		registeredKinds = append(registeredKinds, gk)
 	}
-	return order
 }
 
-// Sort sorts a list of objects by kind order.
-func (so SortOrder) Sort(objects []runtime.Object) {
-	sort.Slice(objects, func(i, j int) bool {
-		vi, ok := so[objects[i].GetObjectKind().GroupVersionKind().Kind]
-		if !ok {
-			vi = math.MaxInt8
+// registered returns the index of gk in registered kinds, or -1 if gk is not registered.
+func registered(gk schema.GroupKind) int {
+	for i, k := range registeredKinds {
+		if k == gk {
+			return i
 		}
-		vj, ok := so[objects[j].GetObjectKind().GroupVersionKind().Kind]
-		if !ok {
-			vj = math.MaxInt8
+	}
+	return -1
+}
+
+// kinds creates GroupKinds for kind in groups.
+func kinds(kind string, groups ...string) []schema.GroupKind {
+	gks := make([]schema.GroupKind, len(groups))
+	for i, group := range groups {
+		gks[i] = schema.GroupKind{Group: group, Kind: kind}
+	}
+	return gks
+}
+
+// builtin returns the rank of gk in built-in kinds, or -1 if gk is not built-in.
+func (so *SortOrder) builtin(gk schema.GroupKind) int {
+	for i, rank := range so.ranks {
+		for _, k := range rank {
+			if k == gk {
+				return i
+			}
 		}
-		return vi < vj
+	}
+	return -1
+}
+
+// rank returns the rank of gk. Objects with lower ranks are sorted first.
+func (so *SortOrder) rank(gk schema.GroupKind) int {
+	builtins := len(so.ranks)
+	extras := len(registeredKinds)
+	if i := so.builtin(gk); i >= 0 {
+		if so.reversed {
+			return 1 + extras + i
+		}
+		return i
+	}
+	if i := registered(gk); i >= 0 {
+		if so.reversed {
+			return extras - i
+		}
+		return builtins + i
+	}
+	if so.reversed {
+		return 0
+	}
+	return builtins + extras
+}
+
+// Sort sorts a list of objects by kind order. Objects of the same rank are
+// sorted by namespaces and names.
+func (so *SortOrder) Sort(objects []runtime.Object) {
+	registryLock.RLock()
+	ranks := make([]int, len(objects))
+	for i, obj := range objects {
+		ranks[i] = so.rank(obj.GetObjectKind().GroupVersionKind().GroupKind())
+	}
+	registryLock.RUnlock()
+	indexes := make([]int, len(objects))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := indexes[i], indexes[j]
+		if ranks[a] != ranks[b] {
+			return ranks[a] < ranks[b]
+		}
+		return nameOf(objects[a]) < nameOf(objects[b])
 	})
+	sorted := make([]runtime.Object, len(objects))
+	for i, index := range indexes {
+		sorted[i] = objects[index]
+	}
+	copy(objects, sorted)
+}
+
+// nameOf returns the namespace and name of obj.
+func nameOf(obj runtime.Object) string {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetNamespace() + "/" + accessor.GetName()
 }
@@ -0,0 +1,136 @@
+package kube
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// objectFor creates an object with a kind, a namespace and a name.
+func objectFor(apiVersion, kind, namespace, name string) runtime.Object {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+// sortedNames returns "Kind namespace/name" of objects.
+func sortedNames(objects []runtime.Object) []string {
+	names := make([]string, len(objects))
+	for i, obj := range objects {
+		names[i] = obj.GetObjectKind().GroupVersionKind().Kind + " " + nameOf(obj)
+	}
+	return names
+}
+
+func TestSortOrder(t *testing.T) {
+	registryLock.Lock()
+	saved := registeredKinds
+	registeredKinds = nil
+	registryLock.Unlock()
+	defer func() {
+		registryLock.Lock()
+		registeredKinds = saved
+		registryLock.Unlock()
+	}()
+
+	foo := schema.GroupKind{Group: "example.com", Kind: "Foo"}
+	bar := schema.GroupKind{Group: "example.com", Kind: "Bar"}
+	// Built-in kinds and duplicated kinds are ignored.
+	RegisterKinds(foo, schema.GroupKind{Kind: "ConfigMap"}, bar, foo)
+	if expected := []schema.GroupKind{foo, bar}; !reflect.DeepEqual(registeredKinds, expected) {
+		t.Fatalf("got registered kinds %v but expected %v", registeredKinds, expected)
+	}
+
+	rankCases := []struct {
+		order    *SortOrder
+		gk       schema.GroupKind
+		expected int
+	}{
+		{InstallOrder, schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}, 0},
+		{InstallOrder, schema.GroupKind{Kind: "Namespace"}, 1},
+		{InstallOrder, schema.GroupKind{Group: "extensions", Kind: "NetworkPolicy"}, 2},
+		{InstallOrder, schema.GroupKind{Group: "networking.k8s.io", Kind: "NetworkPolicy"}, 2},
+		{InstallOrder, schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}, 27},
+		{InstallOrder, foo, 28},
+		{InstallOrder, bar, 29},
+		{InstallOrder, schema.GroupKind{Group: "example.com", Kind: "Baz"}, 30},
+		// Kinds are distinguished by groups.
+		{InstallOrder, schema.GroupKind{Group: "example.com", Kind: "ConfigMap"}, 30},
+		{UninstallOrder, schema.GroupKind{Group: "example.com", Kind: "Baz"}, 0},
+		{UninstallOrder, bar, 1},
+		{UninstallOrder, foo, 2},
+		{UninstallOrder, schema.GroupKind{Group: "extensions", Kind: "Ingress"}, 3},
+		{UninstallOrder, schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}, 30},
+	}
+	for _, tc := range rankCases {
+		if got := tc.order.rank(tc.gk); got != tc.expected {
+			t.Errorf("reversed %v: got rank %d of %v but expected %d", tc.order.reversed, got, tc.gk, tc.expected)
+		}
+	}
+
+	objects := func() []runtime.Object {
+		return []runtime.Object{
+			objectFor("example.com/v1", "Baz", "default", "baz"),
+			objectFor("apps/v1", "Deployment", "default", "web"),
+			objectFor("example.com/v1", "Foo", "default", "foo"),
+			objectFor("v1", "ConfigMap", "default", "b"),
+			objectFor("extensions/v1beta1", "Deployment", "default", "api"),
+			objectFor("example.com/v1", "Bar", "default", "bar"),
+			objectFor("v1", "ConfigMap", "default", "a"),
+			objectFor("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "foos.example.com"),
+			objectFor("v1", "ConfigMap", "apps", "c"),
+			objectFor("v1", "Service", "default", "web"),
+		}
+	}
+	sortCases := []struct {
+		name     string
+		order    *SortOrder
+		expected []string
+	}{
+		{
+			"install",
+			InstallOrder,
+			[]string{
+				"CustomResourceDefinition /foos.example.com",
+				"ConfigMap apps/c",
+				"ConfigMap default/a",
+				"ConfigMap default/b",
+				"Service default/web",
+				"Deployment default/api",
+				"Deployment default/web",
+				"Foo default/foo",
+				"Bar default/bar",
+				"Baz default/baz",
+			},
+		},
+		{
+			"uninstall",
+			UninstallOrder,
+			[]string{
+				"Baz default/baz",
+				"Bar default/bar",
+				"Foo default/foo",
+				"Service default/web",
+				"Deployment default/api",
+				"Deployment default/web",
+				"ConfigMap apps/c",
+				"ConfigMap default/a",
+				"ConfigMap default/b",
+				"CustomResourceDefinition /foos.example.com",
+			},
+		},
+	}
+	for _, tc := range sortCases {
+		objs := objects()
+		tc.order.Sort(objs)
+		if got := sortedNames(objs); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: got order %v but expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
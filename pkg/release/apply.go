@@ -1,33 +1,85 @@
 package release
 
 import (
+	"context"
 	"reflect"
+	"sync"
+	"time"
 
 	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
 	"github.com/caicloud/rudder/pkg/kube"
 	"github.com/caicloud/rudder/pkg/render"
 	"github.com/caicloud/rudder/pkg/storage"
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	helmhooks "k8s.io/helm/pkg/hooks"
 )
 
 // applyRelease wouldn't delete anything. It leaves all antiquated resources to GC. So GC should take
 // latest releases and delete useless resource.
-func (rc *releaseContext) applyRelease(backend storage.ReleaseStorage, release *releaseapi.Release) error {
+func (rc *releaseContext) applyRelease(ctx context.Context, backend storage.ReleaseStorage, release *releaseapi.Release) error {
 	// Deep copy release. Avoid modifying original release.
 	release = release.DeepCopy()
 
-	var manifests []string
+	if release.DeletionTimestamp != nil {
+		return rc.deleteRelease(ctx, backend, release)
+	}
+
+	if storage.DryRun(release) {
+		return rc.dryRunRelease(backend, release)
+	}
+
+	var carrier render.Carrier
+	var hooks []*render.Hook
+	// preEvent and postEvent are the hook events around applying. They are empty
+	// if nothing changed.
+	var preEvent, postEvent string
 	var postUpdate bool
+	// secretValues are values from Secret layers of the version. They are saved
+	// when a new history is created.
+	var secretValues string
 	if release.Spec.RollbackTo != nil {
 		glog.V(4).Infof("Rollback release %s/%s to %v", release.Namespace, release.Name, release.Spec.RollbackTo.Version)
-		// Rollback.
-		rel, err := backend.Rollback(release.Spec.RollbackTo.Version)
+		// Rollback. The version is rendered with its effective config.
+		rollbackValues, err := rc.rollbackValues(backend, release.Spec.RollbackTo.Version)
+		if err != nil {
+			glog.Errorf("Failed to get history %d for release %s/%s: %v", release.Spec.RollbackTo.Version, release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		rel, err := backend.Rollback(release.Spec.RollbackTo.Version, rollbackValues)
 		if err != nil {
 			glog.Errorf("Failed to rollback release %s/%s: %v", release.Namespace, release.Name, err)
 			return recordError(backend, err)
 		}
-		manifests = render.SplitManifest(rel.Status.Manifest)
+		carrier, err = render.CarrierForManifest(rel.Status.Manifest)
+		if err != nil {
+			glog.Errorf("Failed to parse manifest of release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		history, err := backend.History(rel.Status.Version)
+		if err != nil {
+			glog.Errorf("Failed to get history %d for release %s/%s: %v", rel.Status.Version, release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		// Hooks are not a part of manifest. Render the rollbacked release for them.
+		rendered := rel.DeepCopy()
+		rendered.Spec.Config, err = backend.HistoryConfig(history)
+		if err != nil {
+			glog.Errorf("Failed to restore values of history %s/%s: %v", history.Namespace, history.Name, err)
+			return recordError(backend, err)
+		}
+		patches, err := storage.HistoryPatches(history)
+		if err != nil {
+			return recordError(backend, err)
+		}
+		rolledBack, err := rc.renderRelease(rendered, nil, patches, storage.RenderTime(history))
+		if err != nil {
+			glog.Errorf("Failed to render hooks of release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		hooks = rolledBack.Hooks()
+		preEvent, postEvent = helmhooks.PreRollback, helmhooks.PostRollback
 	} else {
 		glog.V(4).Infof("Apply release %s/%s", release.Namespace, release.Name)
 
@@ -44,8 +96,34 @@ func (rc *releaseContext) applyRelease(backend storage.ReleaseStorage, release *
 
 		// calculate version
 		var correctedVersion, nextVersion int32
+		// A new version is rendered with current time and patches. An existing
+		// version is always rendered with its original time and patches.
+		renderTime := time.Unix(time.Now().Unix(), 0)
+		patches := render.PatchesFor(release.Namespace, rc.patches)
+
+		// Resolve values layers. The provenance of layers and the effective config
+		// are recorded in the history of the version. Values from Secret layers
+		// are kept in a Secret owned by the history.
+		layers, provenance, err := rc.resolveValues(release)
+		if err != nil {
+			glog.Errorf("Failed to resolve values of release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		config, err := render.MergeConfig(release.Spec.Config, layers)
+		if err != nil {
+			glog.Errorf("Failed to merge values of release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		publicValues, secret, err := render.SplitConfig(release.Spec.Config, layers)
+		if err != nil {
+			glog.Errorf("Failed to merge values of release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		if err := storage.SetEffectiveValues(release, provenance, publicValues, storage.ConfigDigest(config)); err != nil {
+			return recordError(backend, err)
+		}
+		secretValues = secret
 
-		var err error
 		// find the history with version
 		// get the history with biggest version
 		histories, err := backend.Histories()
@@ -56,6 +134,7 @@ func (rc *releaseContext) applyRelease(backend storage.ReleaseStorage, release *
 
 		if len(histories) == 0 {
 			nextVersion = 1
+			preEvent, postEvent = helmhooks.PreInstall, helmhooks.PostInstall
 		} else {
 			var currentHistory *releaseapi.ReleaseHistory
 			latestHistory := &histories[0]
@@ -72,8 +151,13 @@ func (rc *releaseContext) applyRelease(backend storage.ReleaseStorage, release *
 				}
 			}
 
+			// Referenced values which were changed before a rollback are ignored
+			// until they are changed again.
+			valuesChanged := release.Annotations[storage.AnnotationValuesProvenance] != currentHistory.Annotations[storage.AnnotationValuesProvenance] &&
+				release.Annotations[storage.AnnotationValuesProvenance] != release.Annotations[storage.AnnotationRollbackValues]
 			if release.Spec.Config != currentHistory.Spec.Config ||
-				!reflect.DeepEqual(release.Spec.Template, currentHistory.Spec.Template) {
+				!reflect.DeepEqual(release.Spec.Template, currentHistory.Spec.Template) ||
+				valuesChanged {
 				changed = true
 			}
 
@@ -82,59 +166,116 @@ func (rc *releaseContext) applyRelease(backend storage.ReleaseStorage, release *
 			if !changed {
 				// nothing changed, nextVersion is correctedVersion
 				nextVersion = correctedVersion
+				renderTime = storage.RenderTime(currentHistory)
+				patches, err = storage.HistoryPatches(currentHistory)
+				if err != nil {
+					return recordError(backend, err)
+				}
+				config, err = backend.HistoryConfig(currentHistory)
+				if err != nil {
+					glog.Errorf("Failed to restore values of history %s/%s: %v", currentHistory.Namespace, currentHistory.Name, err)
+					return recordError(backend, err)
+				}
 			} else {
 				// if somthing changed, the nextVersion always be latestVersion + 1
 				nextVersion = latestVersion + 1
+				preEvent, postEvent = helmhooks.PreUpgrade, helmhooks.PostUpgrade
 			}
 
 		}
 
 		release.Status.Version = nextVersion
+		storage.SetRenderTime(release, renderTime)
+		if err := storage.SetPatches(release, patches); err != nil {
+			return recordError(backend, err)
+		}
 
 		// check the manifests
-
-		// FIX: use temporary render to avoid concurrent issue
-		carrier, err := render.NewRender().Render(&render.Options{
-			Namespace: release.Namespace,
-			Release:   release.Name,
-			Version:   release.Status.Version,
-			Template:  release.Spec.Template,
-			Config:    release.Spec.Config,
-			Suspend:   release.Spec.Suspend,
-		})
+		rendered := release.DeepCopy()
+		rendered.Spec.Config = config
+		carrier, err = rc.renderRelease(rendered, nil, patches, renderTime)
 		if err != nil {
 			// Record error status
 			glog.Errorf("Failed to render release %s/%s: %v", release.Namespace, release.Name, err)
 			return recordError(backend, err)
 		}
 
-		manifests = carrier.Resources()
-		release.Status.Manifest = render.MergeResources(manifests)
+		hooks = carrier.Hooks()
+		storage.SetNotes(release, carrier.Notes())
+		release.Status.Manifest = render.MergeResources(carrier.Resources())
 		postUpdate = true
 	}
+
+	// Releases with pre-delete hooks can't be removed until the hooks are executed.
+	if err := rc.setFinalizer(backend, hooks); err != nil {
+		glog.Errorf("Failed to set finalizer of release %s/%s: %v", release.Namespace, release.Name, err)
+		return recordError(backend, err)
+	}
+
+	conditions := []releaseapi.ReleaseCondition{storage.Condition(storage.ReleaseReasonAvailable, "")}
+	if preEvent != "" {
+		hookConditions, err := rc.runHooks(ctx, release, hooks, preEvent)
+		if err == errSuperseded {
+			glog.V(4).Infof("Stop running hooks for release %s/%s: %v", release.Namespace, release.Name, err)
+			return err
+		}
+		if err != nil {
+			glog.Errorf("Failed to run hooks for release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		conditions = append(conditions, hookConditions...)
+	}
+
 	// FIXME: when the number of failure larger than 3 which set int function handler, the resource will apply failed and the
 	// resource can not be consistent with the Spec.Config
 	// Apply resources.
-	if err := rc.client.Apply(release.Namespace, manifests, kube.ApplyOptions{
-		OwnerReferences: referencesForRelease(release),
-		Checker:         rc.ignore,
-	}); err != nil {
+	decisions := newImmutableDecisions()
+	waveConditions, err := rc.applyWaves(ctx, backend, release, carrier, decisions)
+	if err == errSuperseded {
+		glog.V(4).Infof("Stop applying release %s/%s: %v", release.Namespace, release.Name, err)
+		return err
+	}
+	if err != nil {
 		glog.Infof("Failed to apply resources for release %s/%s: %v", release.Namespace, release.Name, err)
+		if _, e := backend.Patch(func(rel *releaseapi.Release) {
+			setImmutableDetails(rel, decisions)
+		}); e != nil {
+			glog.Errorf("Failed to record immutable decisions of release %s/%s: %v", release.Namespace, release.Name, e)
+		}
 		return recordError(backend, err)
 	}
+	conditions = append(conditions, waveConditions...)
 
 	// Updates release after applying the manifests, otherwise the resource applied by manifests
 	// can not be consistent with the manifests when release updated successfully and apply failed.
 	if postUpdate {
 		glog.V(4).Infof("Update manifest of release %s/%s for version %d", release.Namespace, release.Name, release.Status.Version)
-		_, err := backend.Update(release)
+		_, err := backend.Update(release, secretValues)
 		if err != nil {
 			glog.Errorf("Failed to update release %s/%s: %v", release.Namespace, release.Name, err)
 			return recordError(backend, err)
 		}
 	}
 
-	_, err := backend.FlushConditions(storage.Condition(storage.ReleaseReasonAvailable, ""))
+	if postEvent != "" {
+		hookConditions, err := rc.runHooks(ctx, release, hooks, postEvent)
+		if err == errSuperseded {
+			glog.V(4).Infof("Stop running hooks for release %s/%s: %v", release.Namespace, release.Name, err)
+			return err
+		}
+		if err != nil {
+			glog.Errorf("Failed to run hooks for release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		conditions = append(conditions, hookConditions...)
+	}
+
+	_, err = backend.Patch(func(rel *releaseapi.Release) {
+		storage.SetRenderError(rel, nil)
+		setApplyDetails(rel, nil)
+		setImmutableDetails(rel, decisions)
+		rel.Status.Conditions = conditions
+	})
 	if err != nil {
 		return err
 	}
@@ -142,44 +283,141 @@ func (rc *releaseContext) applyRelease(backend storage.ReleaseStorage, release *
 	return nil
 }
 
-// ignore checks if an object should be ignored.
+// applyResources applies resources in wave of a carrier. Subcharts are applied
+// before their parents, and siblings are applied in parallel. At most
+// rc.concurrency nodes are applied at the same time. If some nodes failed, an
+// applyError is returned and the parents of failed nodes are not applied. Nodes
+// which are not started when ctx is done are skipped and errSuperseded is
+// returned.
+func (rc *releaseContext) applyResources(ctx context.Context, release *releaseapi.Release, carrier render.Carrier, wave int, decisions *immutableDecisions) error {
+	concurrency := rc.concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	tokens := make(chan struct{}, concurrency)
+	lock := sync.Mutex{}
+	failures := make(map[string]error)
+	err := carrier.Run(ctx, render.PositiveOrder, func(ctx context.Context, node string, all []string) error {
+		resources := make([]string, 0, len(all))
+		for _, r := range all {
+			// CRDs are applied by applyCRDs before all resources.
+			if render.WaveOf(r) == wave && !isCRD(r) {
+				resources = append(resources, r)
+			}
+		}
+		if len(resources) <= 0 {
+			return nil
+		}
+		select {
+		case tokens <- struct{}{}:
+		case <-ctx.Done():
+			return errSuperseded
+		}
+		defer func() { <-tokens }()
+		glog.V(4).Infof("Apply %d resources of node %s for release %s/%s", len(resources), node, release.Namespace, release.Name)
+		options := rc.applyOptions(release)
+		options.Recorder = decisions.recorderFor(node)
+		err := rc.client.Apply(release.Namespace, resources, options)
+		if err != nil {
+			lock.Lock()
+			failures[node] = err
+			lock.Unlock()
+		}
+		return err
+	})
+	if len(failures) > 0 {
+		return &applyError{failures}
+	}
+	if err != nil && ctx.Err() != nil {
+		return errSuperseded
+	}
+	return err
+}
+
+// applyOptions returns options to apply resources of a release.
+func (rc *releaseContext) applyOptions(release *releaseapi.Release) kube.ApplyOptions {
+	return kube.ApplyOptions{
+		OwnerReferences: referencesForRelease(release),
+		Checker:         rc.ignore,
+		ServerSide:      rc.fieldManager != "",
+		FieldManager:    rc.fieldManager,
+		Force:           storage.ForceConflicts(release),
+	}
+}
+
+// ignore checks if an object should be ignored. CRDs are not ignored here, but
+// they never have owner references and are never deleted by the gc controller.
 func (rc *releaseContext) ignore(obj runtime.Object) bool {
+	gvk := obj.GetObjectKind().GroupVersionKind()
 	for _, i := range rc.ignored {
-		if i == obj.GetObjectKind().GroupVersionKind() {
+		if i == gvk {
 			return true
 		}
 	}
 	return false
 }
 
-// fix modifies new object.
-//func (rc *releaseContext) fix(origin, new, current runtime.Object) error {
-//	switch origin.GetObjectKind().GroupVersionKind() {
-//	case core.SchemeGroupVersion.WithKind("Service"):
-//		// Fix service when convert NodePort to ClusterIP.
-//		o, ok := origin.(*core.Service)
-//		if !ok {
-//			return fmt.Errorf("can't convert origin object %v to service", origin.GetObjectKind())
-//		}
-//		n, ok := new.(*core.Service)
-//		if !ok {
-//			return fmt.Errorf("can't convert new object %v to service", new.GetObjectKind())
-//		}
-//		c, ok := current.(*core.Service)
-//		if !ok {
-//			return fmt.Errorf("can't convert current object %v to service", current.GetObjectKind())
-//		}
-//		if o.Spec.Type == core.ServiceTypeNodePort && n.Spec.Type == core.ServiceTypeClusterIP {
-//			// Set NodePort for origin object
-//			for i := 0; i < len(o.Spec.Ports) && i < len(c.Spec.Ports); i++ {
-//				o.Spec.Ports[i].NodePort = c.Spec.Ports[i].NodePort
-//			}
-//			// Clear NodePort for new object
-//			ports := n.Spec.Ports
-//			for i := range ports {
-//				ports[i].NodePort = 0
-//			}
-//		}
-//	}
-//	return nil
-//}
+// deleteRelease runs pre-delete hooks of a release which is being deleted. The
+// release is kept by its finalizer until the hooks succeed, so resources of the
+// release are still there when the hooks are running. Hooks are rendered with
+// the current version of the release. Waiting for the hooks stops when ctx is
+// done.
+func (rc *releaseContext) deleteRelease(ctx context.Context, backend storage.ReleaseStorage, release *releaseapi.Release) error {
+	current, err := backend.Release()
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if !storage.HasFinalizer(current) {
+		// Hooks have been executed.
+		return nil
+	}
+	glog.V(4).Infof("Delete release %s/%s", release.Namespace, release.Name)
+	history, err := backend.History(release.Status.Version)
+	if err != nil && !errors.IsNotFound(err) {
+		glog.Errorf("Failed to get history %d for release %s/%s: %v", release.Status.Version, release.Namespace, release.Name, err)
+		return recordError(backend, err)
+	}
+	if err == nil {
+		// The spec of release may be changed but not applied. Render the version
+		// which is running.
+		rendered := release.DeepCopy()
+		rendered.Spec.Template = history.Spec.Template
+		rendered.Spec.Config, err = backend.HistoryConfig(history)
+		if err != nil {
+			glog.Errorf("Failed to restore values of history %s/%s: %v", history.Namespace, history.Name, err)
+			return recordError(backend, err)
+		}
+		patches, err := storage.HistoryPatches(history)
+		if err != nil {
+			return recordError(backend, err)
+		}
+		carrier, err := rc.renderRelease(rendered, nil, patches, storage.RenderTime(history))
+		if err != nil {
+			glog.Errorf("Failed to render hooks of release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+		if _, err := rc.runHooks(ctx, release, carrier.Hooks(), helmhooks.PreDelete); err == errSuperseded {
+			return err
+		} else if err != nil {
+			glog.Errorf("Failed to run hooks for release %s/%s: %v", release.Namespace, release.Name, err)
+			return recordError(backend, err)
+		}
+	}
+	_, err = backend.Patch(func(rel *releaseapi.Release) {
+		storage.SetFinalizer(rel, false)
+	})
+	return err
+}
+
+// setFinalizer adds the finalizer to a release if it has pre-delete hooks, or
+// removes the finalizer if not.
+func (rc *releaseContext) setFinalizer(backend storage.ReleaseStorage, hooks []*render.Hook) error {
+	required := len(render.HooksFor(hooks, helmhooks.PreDelete)) > 0
+	_, err := backend.Patch(func(rel *releaseapi.Release) {
+		storage.SetFinalizer(rel, required)
+	})
+	return err
+}
@@ -0,0 +1,160 @@
+package release
+
+import (
+	"fmt"
+	"time"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/helm/pkg/releaseutil"
+)
+
+const (
+	// crdTimeout is the max duration to wait for CRDs to be established.
+	crdTimeout = 2 * time.Minute
+	// crdInterval is the interval to check if CRDs are established.
+	crdInterval = time.Second
+)
+
+// crdsIn returns CRDs in resources.
+func crdsIn(resources []string) ([]string, error) {
+	crds := make([]string, 0)
+	for _, r := range resources {
+		head := releaseutil.SimpleHead{}
+		if err := yaml.Unmarshal([]byte(r), &head); err != nil {
+			return nil, err
+		}
+		if kube.IsCRD(schema.FromAPIVersionAndKind(head.Version, head.Kind)) {
+			crds = append(crds, r)
+		}
+	}
+	return crds, nil
+}
+
+// isCRD checks if resource is a CRD. Invalid resources are not CRDs.
+func isCRD(resource string) bool {
+	head := releaseutil.SimpleHead{}
+	if err := yaml.Unmarshal([]byte(resource), &head); err != nil {
+		return false
+	}
+	return kube.IsCRD(schema.FromAPIVersionAndKind(head.Version, head.Kind))
+}
+
+// crdDefinition contains fields of a CRD which define its kind.
+type crdDefinition struct {
+	Spec struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Names   struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Versions []struct {
+			Name string `json:"name"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+// unservedKinds returns kinds which are defined by crds but not served by the
+// api server yet.
+func (rc *releaseContext) unservedKinds(crds []string) (map[schema.GroupKind]bool, error) {
+	kinds := make(map[schema.GroupKind]bool)
+	for _, crd := range crds {
+		def := crdDefinition{}
+		if err := yaml.Unmarshal([]byte(crd), &def); err != nil {
+			return nil, err
+		}
+		versions := []string{def.Spec.Version}
+		for _, v := range def.Spec.Versions {
+			versions = append(versions, v.Name)
+		}
+		gk := schema.GroupKind{Group: def.Spec.Group, Kind: def.Spec.Names.Kind}
+		served := false
+		for _, v := range versions {
+			if v == "" || rc.resources == nil {
+				continue
+			}
+			if _, err := rc.resources.ResourceFor(gk.WithVersion(v)); err == nil {
+				served = true
+				break
+			}
+		}
+		if !served {
+			kinds[gk] = true
+		}
+	}
+	return kinds, nil
+}
+
+// applyCRDs applies CRDs in resources before other resources. It waits until
+// all CRDs are established and refreshes api resources. Then instances of
+// these CRDs can be applied.
+func (rc *releaseContext) applyCRDs(release *releaseapi.Release, resources []string) error {
+	crds, err := crdsIn(resources)
+	if err != nil || len(crds) <= 0 {
+		return err
+	}
+	glog.V(4).Infof("Apply %d CRDs for release %s/%s", len(crds), release.Namespace, release.Name)
+	if err := rc.client.Apply(release.Namespace, crds, rc.applyOptions(release)); err != nil {
+		return err
+	}
+	err = wait.PollImmediate(crdInterval, crdTimeout, func() (bool, error) {
+		objs, err := rc.client.Get(release.Namespace, crds, kube.GetOptions{IgnoreNonexistence: true})
+		if err != nil {
+			return false, err
+		}
+		if len(objs) < len(crds) {
+			return false, nil
+		}
+		for _, obj := range objs {
+			established, err := crdEstablished(obj)
+			if err != nil || !established {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("CRDs are not established: %v", err)
+	}
+	if rc.resources != nil {
+		return rc.resources.Refresh()
+	}
+	return nil
+}
+
+// crdEstablished checks if the Established condition of a CRD is True. CRDs
+// may be typed or unstructured, so conditions are read from unstructured content.
+func crdEstablished(obj runtime.Object) (bool, error) {
+	var content map[string]interface{}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		content = u.Object
+	} else {
+		var err error
+		content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return false, err
+		}
+	}
+	// Conditions of typed CRDs are null before they are set.
+	value, _, err := unstructured.NestedFieldNoCopy(content, "status", "conditions")
+	if err != nil || value == nil {
+		return false, err
+	}
+	conditions, ok := value.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("invalid conditions of CRD: %v", value)
+	}
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
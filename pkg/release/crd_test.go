@@ -0,0 +1,262 @@
+package release
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	apiextensions "github.com/caicloud/clientset/pkg/apis/apiextensions/v1beta1"
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// fakeResources serves kinds in served.
+type fakeResources struct {
+	served    map[schema.GroupVersionKind]bool
+	refreshed int
+}
+
+func (r *fakeResources) ResourceFor(gvk schema.GroupVersionKind) (*kube.Resource, error) {
+	if !r.served[gvk] {
+		return nil, fmt.Errorf("no resource for %v", gvk)
+	}
+	return &kube.Resource{Group: gvk.Group, Version: gvk.Version, APIResource: metav1.APIResource{Kind: gvk.Kind}}, nil
+}
+
+func (r *fakeResources) Resources() map[schema.GroupVersionKind]*kube.Resource {
+	return nil
+}
+
+func (r *fakeResources) ServerVersion() *version.Info {
+	return &version.Info{}
+}
+
+func (r *fakeResources) Refresh() error {
+	r.refreshed++
+	return nil
+}
+
+func (r *fakeResources) OnRemove(handler func(gvk schema.GroupVersionKind)) {}
+
+const (
+	// crdWithVersion defines a kind by spec.version.
+	crdWithVersion = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: crontabs.stable.example.com
+spec:
+  group: stable.example.com
+  version: v1
+  names:
+    kind: CronTab`
+	// crdWithVersions defines a kind by spec.versions.
+	crdWithVersions = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: backups.stable.example.com
+spec:
+  group: stable.example.com
+  versions:
+  - name: v1beta1
+  - name: v1
+  names:
+    kind: Backup`
+)
+
+func TestUnservedKinds(t *testing.T) {
+	crontab := schema.GroupKind{Group: "stable.example.com", Kind: "CronTab"}
+	backup := schema.GroupKind{Group: "stable.example.com", Kind: "Backup"}
+	testCases := []struct {
+		name      string
+		resources kube.APIResources
+		expected  map[schema.GroupKind]bool
+	}{
+		{
+			"no api resources",
+			nil,
+			map[schema.GroupKind]bool{crontab: true, backup: true},
+		},
+		{
+			"nothing served",
+			&fakeResources{},
+			map[schema.GroupKind]bool{crontab: true, backup: true},
+		},
+		{
+			"served by spec.version",
+			&fakeResources{served: map[schema.GroupVersionKind]bool{crontab.WithVersion("v1"): true}},
+			map[schema.GroupKind]bool{backup: true},
+		},
+		{
+			"served by spec.versions",
+			&fakeResources{served: map[schema.GroupVersionKind]bool{backup.WithVersion("v1"): true}},
+			map[schema.GroupKind]bool{crontab: true},
+		},
+		{
+			"other versions served",
+			&fakeResources{served: map[schema.GroupVersionKind]bool{
+				crontab.WithVersion("v2"):      true,
+				backup.WithVersion("v1beta1"): true,
+			}},
+			map[schema.GroupKind]bool{crontab: true},
+		},
+	}
+	for _, tc := range testCases {
+		rc := &releaseContext{resources: tc.resources}
+		kinds, err := rc.unservedKinds([]string{crdWithVersion, crdWithVersions})
+		if err != nil {
+			t.Errorf("%s: can't get unserved kinds: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(kinds, tc.expected) {
+			t.Errorf("%s: got unserved kinds %v but expected %v", tc.name, kinds, tc.expected)
+		}
+	}
+}
+
+// unstructuredCRD creates an unstructured CRD with conditions.
+func unstructuredCRD(conditions ...interface{}) *unstructured.Unstructured {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1beta1",
+		"kind":       "CustomResourceDefinition",
+	}}
+	if len(conditions) > 0 {
+		crd.Object["status"] = map[string]interface{}{"conditions": conditions}
+	}
+	return crd
+}
+
+// typedCRD creates a typed CRD with conditions.
+func typedCRD(conditions ...apiextensions.CustomResourceDefinitionCondition) *apiextensions.CustomResourceDefinition {
+	crd := &apiextensions.CustomResourceDefinition{}
+	crd.Status.Conditions = conditions
+	return crd
+}
+
+func TestCRDEstablished(t *testing.T) {
+	testCases := []struct {
+		name        string
+		obj         runtime.Object
+		established bool
+		err         bool
+	}{
+		{"unstructured without status", unstructuredCRD(), false, false},
+		{
+			"unstructured established",
+			unstructuredCRD(
+				map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+				map[string]interface{}{"type": "Established", "status": "True"},
+			),
+			true,
+			false,
+		},
+		{
+			"unstructured not established",
+			unstructuredCRD(map[string]interface{}{"type": "Established", "status": "False"}),
+			false,
+			false,
+		},
+		{
+			"unstructured names accepted",
+			unstructuredCRD(map[string]interface{}{"type": "NamesAccepted", "status": "True"}),
+			false,
+			false,
+		},
+		{
+			"unstructured invalid conditions",
+			&unstructured.Unstructured{Object: map[string]interface{}{
+				"status": map[string]interface{}{"conditions": "Established"},
+			}},
+			false,
+			true,
+		},
+		{"typed without status", typedCRD(), false, false},
+		{
+			"typed established",
+			typedCRD(apiextensions.CustomResourceDefinitionCondition{
+				Type: apiextensions.Established, Status: apiextensions.ConditionTrue,
+			}),
+			true,
+			false,
+		},
+		{
+			"typed not established",
+			typedCRD(apiextensions.CustomResourceDefinitionCondition{
+				Type: apiextensions.Established, Status: apiextensions.ConditionUnknown,
+			}),
+			false,
+			false,
+		},
+	}
+	for _, tc := range testCases {
+		established, err := crdEstablished(tc.obj)
+		if established != tc.established {
+			t.Errorf("%s: expected established %v but got %v", tc.name, tc.established, established)
+		}
+		if (err != nil) != tc.err {
+			t.Errorf("%s: expected error %v but got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestApplyCRDs(t *testing.T) {
+	release := &releaseapi.Release{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	crontab := "apiVersion: stable.example.com/v1\nkind: CronTab\nmetadata:\n  name: backup"
+	established := apiextensions.CustomResourceDefinitionCondition{
+		Type: apiextensions.Established, Status: apiextensions.ConditionTrue,
+	}
+	testCases := []struct {
+		name      string
+		resources []string
+		objects   map[string]runtime.Object
+		calls     []string
+		refreshed int
+	}{
+		{
+			"no CRDs",
+			[]string{crontab},
+			nil,
+			nil,
+			0,
+		},
+		{
+			"typed CRDs",
+			[]string{crontab, crdWithVersion},
+			map[string]runtime.Object{crdWithVersion: typedCRD(established)},
+			[]string{"Apply " + crdWithVersion},
+			1,
+		},
+		{
+			"unstructured CRDs",
+			[]string{crdWithVersion, crontab, crdWithVersions},
+			map[string]runtime.Object{
+				crdWithVersion: unstructuredCRD(map[string]interface{}{"type": "Established", "status": "True"}),
+				crdWithVersions: unstructuredCRD(
+					map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+					map[string]interface{}{"type": "Established", "status": "True"},
+				),
+			},
+			[]string{"Apply " + crdWithVersion + "," + crdWithVersions},
+			1,
+		},
+	}
+	for _, tc := range testCases {
+		client := &fakeClient{objects: tc.objects}
+		resources := &fakeResources{}
+		rc := &releaseContext{client: client, resources: resources}
+		if err := rc.applyCRDs(release, tc.resources); err != nil {
+			t.Errorf("%s: can't apply CRDs: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(client.calls, tc.calls) {
+			t.Errorf("%s: got calls %v but expected %v", tc.name, client.calls, tc.calls)
+		}
+		if resources.refreshed != tc.refreshed {
+			t.Errorf("%s: api resources are refreshed %d times but expected %d", tc.name, resources.refreshed, tc.refreshed)
+		}
+	}
+}
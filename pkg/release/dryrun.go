@@ -0,0 +1,110 @@
+package release
+
+import (
+	"fmt"
+	"time"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
+	"github.com/caicloud/rudder/pkg/storage"
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// dryRunRelease renders a release and applies its resources with server-side
+// dry-run. Results are recorded in the release. Hooks are not executed and the
+// version of the release is not changed.
+func (rc *releaseContext) dryRunRelease(backend storage.ReleaseStorage, release *releaseapi.Release) error {
+	glog.V(4).Infof("Dry-run release %s/%s", release.Namespace, release.Name)
+	layers, _, err := rc.resolveValues(release)
+	if err != nil {
+		glog.Errorf("Failed to resolve values of release %s/%s: %v", release.Namespace, release.Name, err)
+		return recordError(backend, err)
+	}
+	carrier, err := rc.renderRelease(release, layers, render.PatchesFor(release.Namespace, rc.patches), time.Unix(time.Now().Unix(), 0))
+	if err != nil {
+		glog.Errorf("Failed to render release %s/%s: %v", release.Namespace, release.Name, err)
+		return recordError(backend, err)
+	}
+	resources, skipped, err := rc.skipUnservedInstances(carrier.Resources())
+	if err != nil {
+		glog.Errorf("Failed to parse CRDs of release %s/%s: %v", release.Namespace, release.Name, err)
+		return recordError(backend, err)
+	}
+	results, err := rc.client.DryRun(release.Namespace, resources, rc.applyOptions(release))
+	if err != nil {
+		glog.Errorf("Failed to dry-run release %s/%s: %v", release.Namespace, release.Name, err)
+		return recordError(backend, err)
+	}
+	results = append(results, skipped...)
+	var patchErr error
+	_, err = backend.Patch(func(rel *releaseapi.Release) {
+		storage.SetRenderError(rel, nil)
+		patchErr = storage.SetDryRunResults(rel, results)
+		// An explicit condition stops the release from being dry-run again
+		// until it's changed.
+		rel.Status.Conditions = []releaseapi.ReleaseCondition{storage.Condition(storage.ReleaseReasonDryRun, dryRunSummary(results))}
+	})
+	if err == nil {
+		err = patchErr
+	}
+	return err
+}
+
+// skipUnservedInstances removes instances of CRDs which are in resources but not
+// served by the api server. A dry-run doesn't create CRDs, so these instances
+// would always be rejected. They are returned as skipped results.
+func (rc *releaseContext) skipUnservedInstances(resources []string) ([]string, []kube.DryRunResult, error) {
+	crds, err := crdsIn(resources)
+	if err != nil || len(crds) <= 0 {
+		return resources, nil, err
+	}
+	kinds, err := rc.unservedKinds(crds)
+	if err != nil || len(kinds) <= 0 {
+		return resources, nil, err
+	}
+	kept := make([]string, 0, len(resources))
+	skipped := make([]kube.DryRunResult, 0)
+	for _, r := range resources {
+		head := struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}{}
+		if err := yaml.Unmarshal([]byte(r), &head); err != nil {
+			return nil, nil, err
+		}
+		gk := schema.FromAPIVersionAndKind(head.APIVersion, head.Kind).GroupKind()
+		if !kinds[gk] {
+			kept = append(kept, r)
+			continue
+		}
+		skipped = append(skipped, kube.DryRunResult{
+			Kind:    head.Kind,
+			Name:    head.Metadata.Name,
+			Skipped: true,
+			Reason:  fmt.Sprintf("CRD of %s is not created yet", gk),
+		})
+	}
+	return kept, skipped, nil
+}
+
+// dryRunSummary counts results of a dry-run.
+func dryRunSummary(results []kube.DryRunResult) string {
+	accepted, rejected, skipped := 0, 0, 0
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			skipped++
+		case r.Accepted:
+			accepted++
+		default:
+			rejected++
+		}
+	}
+	return fmt.Sprintf("Dry-run: %d accepted, %d rejected, %d skipped", accepted, rejected, skipped)
+}
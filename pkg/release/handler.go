@@ -3,9 +3,12 @@ package release
 import (
 	"context"
 	"reflect"
+	"sync"
 
 	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	statusinterface "github.com/caicloud/rudder-client/status/universal"
 	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
 	"github.com/caicloud/rudder/pkg/storage"
 	"github.com/golang/glog"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -23,14 +26,35 @@ const (
 )
 
 type releaseContext struct {
-	client  kube.Client
-	ignored []schema.GroupVersionKind
+	client       kube.Client
+	ignored      []schema.GroupVersionKind
+	capabilities render.CapabilitiesSource
+	patches      []*render.Patch
+	layers       kube.CacheLayers
+	cache        *render.Cache
+	// concurrency is the max number of chart nodes to apply in parallel.
+	concurrency int
+	// fieldManager is the field manager for server-side apply. Resources are
+	// applied with three-way merge patches if it's empty.
+	fieldManager string
+	// umpire judges if resources of a sync wave are ready.
+	umpire statusinterface.Umpire
+	// resources are refreshed after CRDs in releases are established.
+	resources kube.APIResources
 }
 
-func NewReleaseHandler(client kube.Client, ignored []schema.GroupVersionKind) Handler {
+func NewReleaseHandler(client kube.Client, ignored []schema.GroupVersionKind, capabilities render.CapabilitiesSource, patches []*render.Patch, layers kube.CacheLayers, cache *render.Cache, concurrency int, fieldManager string, umpire statusinterface.Umpire, resources kube.APIResources) Handler {
 	return (&releaseContext{
-		client:  client,
-		ignored: ignored,
+		client:       client,
+		ignored:      ignored,
+		capabilities: capabilities,
+		patches:      patches,
+		layers:       layers,
+		cache:        cache,
+		concurrency:  concurrency,
+		fieldManager: fieldManager,
+		umpire:       umpire,
+		resources:    resources,
 	}).handle
 }
 
@@ -40,31 +64,48 @@ func (rc *releaseContext) handle(ctx context.Context, backend storage.ReleaseSto
 
 	// Retry queue.
 	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
-	// target only has single read and single write thread. So don't need a lock here.
-	// target never is nil.
+	// lock protects target and cancel. target is written by the event loop and
+	// read by the worker. target never is nil in the worker.
+	lock := sync.Mutex{}
 	var target *releaseapi.Release
+	// cancel stops waiting in the current apply. A newer event shouldn't wait
+	// for sync waves of an outdated target.
+	cancel := context.CancelFunc(func() {})
+	// values is the digest of values layers of target. Referenced ConfigMaps and
+	// Secrets may be changed without any change of release.
+	var values string
 	go func() {
 		for {
 			_, shutdown := queue.Get()
 			if shutdown {
 				return
 			}
+			lock.Lock()
+			current := target
+			applyCtx, applyCancel := context.WithCancel(ctx)
+			cancel = applyCancel
+			lock.Unlock()
 			// In the past, call handleRelease to judge and select an handler for release.
 			// Now just apply the release.
-			if err := rc.applyRelease(backend, target); err != nil {
-				if queue.NumRequeues(target.Name) < 3 {
+			err := rc.applyRelease(applyCtx, backend, current)
+			applyCancel()
+			if err == errSuperseded {
+				// The newer target is in the queue.
+				queue.Forget(current.Name)
+			} else if err != nil {
+				if queue.NumRequeues(current.Name) < 3 {
 					// Something is wrong. Retry it with rate limit.
-					queue.AddRateLimited(target.Name)
-					glog.Errorf("Can't apply release %s/%s: %v, retry", target.Namespace, target.Name, err)
+					queue.AddRateLimited(current.Name)
+					glog.Errorf("Can't apply release %s/%s: %v, retry", current.Namespace, current.Name, err)
 				} else {
-					glog.Warningf("Dropping release %s/%s", target.Namespace, target.Name)
+					glog.Warningf("Dropping release %s/%s", current.Namespace, current.Name)
 				}
 			} else {
-				glog.V(4).Infof("Successfully handled release: %s/%s", target.Namespace, target.Name)
+				glog.V(4).Infof("Successfully handled release: %s/%s", current.Namespace, current.Name)
 				// Everything is ok. Save target.
-				queue.Forget(target.Name)
+				queue.Forget(current.Name)
 			}
-			queue.Done(target.Name)
+			queue.Done(current.Name)
 		}
 	}()
 FOR:
@@ -73,13 +114,21 @@ FOR:
 		case <-ctx.Done():
 			break FOR
 		case rel := <-getter.Get():
-			if !(target != nil && rel.Spec.RollbackTo == nil &&
+			digest := rc.valuesDigest(rel)
+			if !(target != nil && rel.Spec.RollbackTo == nil && rel.DeletionTimestamp == nil &&
+				values == digest &&
 				target.Spec.Config == rel.Spec.Config &&
+				target.Annotations[storage.AnnotationValuesLayers] == rel.Annotations[storage.AnnotationValuesLayers] &&
+				storage.DryRun(target) == storage.DryRun(rel) &&
 				reflect.DeepEqual(target.Spec.Suspend, rel.Spec.Suspend) &&
 				reflect.DeepEqual(target.Spec.Template, rel.Spec.Template) &&
 				normalCondition(rel)) {
 				// Config was changed. Add it to queue.
+				lock.Lock()
 				target = rel
+				cancel()
+				lock.Unlock()
+				values = digest
 				queue.Forget(target.Name)
 				queue.Add(target.Name)
 			}
@@ -0,0 +1,130 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
+	"github.com/caicloud/rudder/pkg/storage"
+	"github.com/golang/glog"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// hookTimeout is the max duration to wait for a hook to complete.
+	hookTimeout = 5 * time.Minute
+	// hookInterval is the interval to check the status of a hook.
+	hookInterval = 2 * time.Second
+)
+
+// hookError is returned when a hook fails.
+type hookError struct {
+	event string
+	hook  *render.Hook
+	err   error
+}
+
+func (e *hookError) Error() string {
+	return fmt.Sprintf("%s hook %s(%s) failed: %v", e.event, e.hook.Name, e.hook.Kind, e.err)
+}
+
+// runHooks executes all hooks of event in weight order. It returns conditions for
+// succeeded hooks. If a hook failed, the remaining hooks are skipped and a hookError
+// is returned. If ctx is done while waiting for a hook, errSuperseded is returned.
+func (rc *releaseContext) runHooks(ctx context.Context, release *releaseapi.Release, hooks []*render.Hook, event string) ([]releaseapi.ReleaseCondition, error) {
+	conditions := []releaseapi.ReleaseCondition{}
+	for _, hook := range render.HooksFor(hooks, event) {
+		glog.V(4).Infof("Execute %s hook %s(%s) for release %s/%s", event, hook.Name, hook.Kind, release.Namespace, release.Name)
+		if err := rc.runHook(ctx, release, hook); err != nil {
+			if err == errSuperseded {
+				return conditions, err
+			}
+			if hook.HasDeletePolicy(render.HookFailed) {
+				rc.deleteHook(release, hook)
+			}
+			return conditions, &hookError{event, hook, err}
+		}
+		if hook.HasDeletePolicy(render.HookSucceeded) {
+			rc.deleteHook(release, hook)
+		}
+		conditions = append(conditions, storage.Condition(storage.ReleaseReasonHookSucceeded,
+			fmt.Sprintf("%s hook %s(%s) succeeded", event, hook.Name, hook.Kind)))
+	}
+	return conditions, nil
+}
+
+// runHook creates a hook and waits until it is completed. It returns
+// errSuperseded if ctx is done before that.
+func (rc *releaseContext) runHook(ctx context.Context, release *releaseapi.Release, hook *render.Hook) error {
+	resources := []string{hook.Resource}
+	if hook.HasDeletePolicy(render.HookBeforeCreation) {
+		if err := rc.client.Delete(release.Namespace, resources, kube.DeleteOptions{}); err != nil {
+			return err
+		}
+	}
+	// Hooks don't belong to the release. Otherwise they would be collected by GC
+	// because they are not a part of the release manifest.
+	if err := rc.client.Apply(release.Namespace, resources, kube.ApplyOptions{}); err != nil {
+		return err
+	}
+	timeout, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+	err := wait.PollImmediateUntil(hookInterval, func() (bool, error) {
+		objs, err := rc.client.Get(release.Namespace, resources, kube.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return hookCompleted(objs[0])
+	}, timeout.Done())
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return errSuperseded
+	}
+	return err
+}
+
+// deleteHook deletes a hook. Errors are only logged.
+func (rc *releaseContext) deleteHook(release *releaseapi.Release, hook *render.Hook) {
+	err := rc.client.Delete(release.Namespace, []string{hook.Resource}, kube.DeleteOptions{})
+	if err != nil {
+		glog.Errorf("Failed to delete hook %s(%s) for release %s/%s: %v", hook.Name, hook.Kind, release.Namespace, release.Name, err)
+	}
+}
+
+// hookCompleted checks if a hook object is completed. Only Job and Pod need to wait,
+// other kinds are completed once they are created.
+func hookCompleted(obj runtime.Object) (bool, error) {
+	switch o := obj.(type) {
+	case *batchv1.Job:
+		for _, c := range o.Status.Conditions {
+			if c.Status != core.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				return false, fmt.Errorf("job failed: %s", c.Message)
+			}
+		}
+		return false, nil
+	case *core.Pod:
+		switch o.Status.Phase {
+		case core.PodSucceeded:
+			return true, nil
+		case core.PodFailed:
+			return false, fmt.Errorf("pod failed: %s", o.Status.Message)
+		}
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,220 @@
+package release
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// fakeClient is a kube client which returns objects for resources and records
+// calls.
+type fakeClient struct {
+	lock sync.Mutex
+	// objects is a map from resources to objects returned by Get.
+	objects map[string]runtime.Object
+	// calls are calls of the client, like "Apply job".
+	calls []string
+}
+
+func (c *fakeClient) record(method string, resources []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.calls = append(c.calls, method+" "+strings.Join(resources, ","))
+}
+
+func (c *fakeClient) Get(namespace string, resources []string, options kube.GetOptions) ([]runtime.Object, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	objs := make([]runtime.Object, 0, len(resources))
+	for _, r := range resources {
+		if obj, ok := c.objects[r]; ok {
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+func (c *fakeClient) Apply(namespace string, resources []string, options kube.ApplyOptions) error {
+	c.record("Apply", resources)
+	return nil
+}
+
+func (c *fakeClient) DryRun(namespace string, resources []string, options kube.ApplyOptions) ([]kube.DryRunResult, error) {
+	c.record("DryRun", resources)
+	return nil, nil
+}
+
+func (c *fakeClient) Create(namespace string, resources []string, options kube.CreateOptions) error {
+	c.record("Create", resources)
+	return nil
+}
+
+func (c *fakeClient) Update(namespace string, originalResources, targetResources []string, options kube.UpdateOptions) error {
+	c.record("Update", targetResources)
+	return nil
+}
+
+func (c *fakeClient) Delete(namespace string, resources []string, options kube.DeleteOptions) error {
+	c.record("Delete", resources)
+	return nil
+}
+
+func jobWithCondition(conditionType batchv1.JobConditionType, status core.ConditionStatus) *batchv1.Job {
+	job := &batchv1.Job{}
+	if conditionType != "" {
+		job.Status.Conditions = []batchv1.JobCondition{{Type: conditionType, Status: status, Message: "BackoffLimitExceeded"}}
+	}
+	return job
+}
+
+func podInPhase(phase core.PodPhase) *core.Pod {
+	return &core.Pod{Status: core.PodStatus{Phase: phase, Message: "OOMKilled"}}
+}
+
+func TestHookCompleted(t *testing.T) {
+	testCases := []struct {
+		name      string
+		obj       runtime.Object
+		completed bool
+		err       string
+	}{
+		{"job without conditions", jobWithCondition("", ""), false, ""},
+		{"job completed", jobWithCondition(batchv1.JobComplete, core.ConditionTrue), true, ""},
+		{"job not completed", jobWithCondition(batchv1.JobComplete, core.ConditionFalse), false, ""},
+		{"job failed", jobWithCondition(batchv1.JobFailed, core.ConditionTrue), false, "job failed: BackoffLimitExceeded"},
+		{"pod pending", podInPhase(core.PodPending), false, ""},
+		{"pod running", podInPhase(core.PodRunning), false, ""},
+		{"pod succeeded", podInPhase(core.PodSucceeded), true, ""},
+		{"pod failed", podInPhase(core.PodFailed), false, "pod failed: OOMKilled"},
+		{"other kinds", &core.ConfigMap{}, true, ""},
+	}
+	for _, tc := range testCases {
+		completed, err := hookCompleted(tc.obj)
+		if completed != tc.completed {
+			t.Errorf("%s: expected completed %v but got %v", tc.name, tc.completed, completed)
+		}
+		if (err == nil) != (tc.err == "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%s: expected error %q but got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	release := &releaseapi.Release{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	hooks := []*render.Hook{
+		{Name: "migrate", Kind: "Job", Events: []string{"pre-install"}, Weight: 1,
+			DeletePolicies: []string{render.HookSucceeded}, Resource: "migrate"},
+		{Name: "check", Kind: "Pod", Events: []string{"pre-install"},
+			DeletePolicies: []string{render.HookFailed, render.HookBeforeCreation}, Resource: "check"},
+		{Name: "config", Kind: "ConfigMap", Events: []string{"pre-install", "post-install"}, Resource: "config"},
+		{Name: "notify", Kind: "Job", Events: []string{"post-install"}, Weight: -1, Resource: "notify"},
+	}
+	testCases := []struct {
+		name    string
+		event   string
+		objects map[string]runtime.Object
+		// cancel cancels the context before hooks are executed.
+		cancel bool
+		// succeeded are hooks which succeeded in order.
+		succeeded []string
+		calls     []string
+		err       string
+	}{
+		{
+			"all succeeded",
+			"pre-install",
+			map[string]runtime.Object{
+				"migrate": jobWithCondition(batchv1.JobComplete, core.ConditionTrue),
+				"check":   podInPhase(core.PodSucceeded),
+				"config":  &core.ConfigMap{},
+			},
+			false,
+			[]string{"check(Pod)", "config(ConfigMap)", "migrate(Job)"},
+			[]string{"Delete check", "Apply check", "Apply config", "Apply migrate", "Delete migrate"},
+			"",
+		},
+		{
+			"pod failed",
+			"pre-install",
+			map[string]runtime.Object{
+				"migrate": jobWithCondition(batchv1.JobComplete, core.ConditionTrue),
+				"check":   podInPhase(core.PodFailed),
+				"config":  &core.ConfigMap{},
+			},
+			false,
+			[]string{},
+			[]string{"Delete check", "Apply check", "Delete check"},
+			"pre-install hook check(Pod) failed: pod failed: OOMKilled",
+		},
+		{
+			"job failed",
+			"pre-install",
+			map[string]runtime.Object{
+				"migrate": jobWithCondition(batchv1.JobFailed, core.ConditionTrue),
+				"check":   podInPhase(core.PodSucceeded),
+				"config":  &core.ConfigMap{},
+			},
+			false,
+			[]string{"check(Pod)", "config(ConfigMap)"},
+			[]string{"Delete check", "Apply check", "Apply config", "Apply migrate"},
+			"pre-install hook migrate(Job) failed: job failed: BackoffLimitExceeded",
+		},
+		{
+			"other event",
+			"post-install",
+			map[string]runtime.Object{
+				"notify": jobWithCondition(batchv1.JobComplete, core.ConditionTrue),
+				"config": &core.ConfigMap{},
+			},
+			false,
+			[]string{"notify(Job)", "config(ConfigMap)"},
+			[]string{"Apply notify", "Apply config"},
+			"",
+		},
+		{
+			"superseded",
+			"post-install",
+			map[string]runtime.Object{
+				"notify": jobWithCondition("", ""),
+				"config": &core.ConfigMap{},
+			},
+			true,
+			[]string{},
+			[]string{"Apply notify"},
+			errSuperseded.Error(),
+		},
+	}
+	for _, tc := range testCases {
+		client := &fakeClient{objects: tc.objects}
+		rc := &releaseContext{client: client}
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.cancel {
+			cancel()
+		}
+		conditions, err := rc.runHooks(ctx, release, hooks, tc.event)
+		cancel()
+		if (err == nil) != (tc.err == "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%s: expected error %q but got %v", tc.name, tc.err, err)
+		}
+		succeeded := []string{}
+		for _, c := range conditions {
+			succeeded = append(succeeded, strings.Fields(c.Message)[2])
+		}
+		if !reflect.DeepEqual(succeeded, tc.succeeded) {
+			t.Errorf("%s: got succeeded hooks %v but expected %v", tc.name, succeeded, tc.succeeded)
+		}
+		if !reflect.DeepEqual(client.calls, tc.calls) {
+			t.Errorf("%s: got calls %v but expected %v", tc.name, client.calls, tc.calls)
+		}
+	}
+}
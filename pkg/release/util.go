@@ -1,7 +1,15 @@
 package release
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
 	"github.com/caicloud/rudder/pkg/storage"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -16,12 +24,184 @@ func referencesForRelease(release *releaseapi.Release) []metav1.OwnerReference {
 	}}
 }
 
+// renderRelease renders the template and config of a release. layers override
+// the config. renderTime and patches should be the ones of the release version.
+func (rc *releaseContext) renderRelease(release *releaseapi.Release, layers []render.ValuesLayer, patches []*render.Patch, renderTime time.Time) (render.Carrier, error) {
+	// FIX: use temporary render to avoid concurrent issue
+	return render.NewRenderWithCache(rc.cache).Render(&render.Options{
+		Namespace:    release.Namespace,
+		Release:      release.Name,
+		Version:      release.Status.Version,
+		Template:     release.Spec.Template,
+		Config:       release.Spec.Config,
+		Layers:       layers,
+		Suspend:      release.Spec.Suspend,
+		Capabilities: rc.capabilities,
+		Time:         renderTime,
+		Patches:      patches,
+	})
+}
+
 // recordError records err for release.
 func recordError(backend storage.ReleaseStorage, target error) error {
+	reason := storage.ReleaseReasonFailure
+	var renderErr *render.RenderError
+	var failures map[string]error
+	switch e := target.(type) {
+	case *hookError:
+		reason = storage.ReleaseReasonHookFailed
+	case *waveError:
+		reason = storage.ReleaseReasonWaveFailed
+	case *render.RenderError:
+		reason = storage.ReleaseReasonRenderFailed
+		renderErr = e
+	case *storage.ValuesSnapshotError:
+		reason = storage.ReleaseReasonValuesUnavailable
+	case *applyError:
+		failures = e.failures
+		if e.conflicted() {
+			reason = storage.ReleaseReasonApplyConflict
+		} else if e.shrunk() {
+			reason = storage.ReleaseReasonPVCShrinkRejected
+		}
+	}
 	// Record error status
-	_, err := backend.FlushConditions(storage.Condition(storage.ReleaseReasonFailure, target.Error()))
+	_, err := backend.Patch(func(release *releaseapi.Release) {
+		storage.SetRenderError(release, renderErr)
+		setApplyDetails(release, failures)
+		release.Status.Conditions = []releaseapi.ReleaseCondition{storage.Condition(reason, target.Error())}
+	})
 	if err == nil {
 		return target
 	}
 	return err
 }
+
+// applyDetailKind is the kind of release details for apply failures. Details of
+// the kind are keyed by "apply:<node>".
+const applyDetailKind = "apply"
+
+// applyError is returned when resources of some nodes failed to apply.
+type applyError struct {
+	// failures is a node-error map.
+	failures map[string]error
+}
+
+func (e *applyError) Error() string {
+	nodes := make([]string, 0, len(e.failures))
+	for node := range e.failures {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	msgs := make([]string, len(nodes))
+	for i, node := range nodes {
+		msgs[i] = fmt.Sprintf("%s: %v", node, e.failures[node])
+	}
+	return fmt.Sprintf("failed to apply %d nodes: %s", len(nodes), strings.Join(msgs, "; "))
+}
+
+// conflicted checks if any node failed because of conflicts of field managers.
+func (e *applyError) conflicted() bool {
+	for _, err := range e.failures {
+		if _, ok := err.(*kube.ConflictError); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// shrunk checks if any node failed because storage requests of PVCs are decreased.
+func (e *applyError) shrunk() bool {
+	for _, err := range e.failures {
+		if _, ok := err.(*kube.ShrinkError); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// setApplyDetails replaces apply failures in release details. Details of other
+// kinds are kept.
+func setApplyDetails(release *releaseapi.Release, failures map[string]error) {
+	prefix := applyDetailKind + ":"
+	for key := range release.Status.Details {
+		if strings.HasPrefix(key, prefix) {
+			delete(release.Status.Details, key)
+		}
+	}
+	if len(failures) <= 0 {
+		return
+	}
+	if release.Status.Details == nil {
+		release.Status.Details = make(map[string]releaseapi.ReleaseDetailStatus)
+	}
+	for node, err := range failures {
+		reason := "ApplyFailed"
+		switch err.(type) {
+		case *kube.ConflictError:
+			reason = string(storage.ReleaseReasonApplyConflict)
+		case *kube.ShrinkError:
+			reason = string(storage.ReleaseReasonPVCShrinkRejected)
+		}
+		release.Status.Details[prefix+node] = releaseapi.ReleaseDetailStatus{
+			Path:    node,
+			Reason:  reason,
+			Message: err.Error(),
+		}
+	}
+}
+
+// immutableDetailKind is the kind of release details for changes of immutable
+// fields. Details of the kind are keyed by "immutable:<node>".
+const immutableDetailKind = "immutable"
+
+// immutableDecisions collects decisions for changes of immutable fields by nodes.
+type immutableDecisions struct {
+	lock  sync.Mutex
+	nodes map[string][]kube.ImmutableDecision
+}
+
+func newImmutableDecisions() *immutableDecisions {
+	return &immutableDecisions{
+		nodes: make(map[string][]kube.ImmutableDecision),
+	}
+}
+
+// recorderFor returns a recorder for decisions of a node.
+func (d *immutableDecisions) recorderFor(node string) kube.ImmutableRecorder {
+	return func(decision kube.ImmutableDecision) {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.nodes[node] = append(d.nodes[node], decision)
+	}
+}
+
+// setImmutableDetails replaces immutable decisions in release details. Details of
+// other kinds are kept.
+func setImmutableDetails(release *releaseapi.Release, decisions *immutableDecisions) {
+	prefix := immutableDetailKind + ":"
+	for key := range release.Status.Details {
+		if strings.HasPrefix(key, prefix) {
+			delete(release.Status.Details, key)
+		}
+	}
+	decisions.lock.Lock()
+	defer decisions.lock.Unlock()
+	if len(decisions.nodes) <= 0 {
+		return
+	}
+	if release.Status.Details == nil {
+		release.Status.Details = make(map[string]releaseapi.ReleaseDetailStatus)
+	}
+	for node, list := range decisions.nodes {
+		msgs := make([]string, len(list))
+		for i, d := range list {
+			msgs[i] = fmt.Sprintf("%s %s: %s (%s)", d.Kind, d.Name, d.Policy, strings.Join(d.Fields, ", "))
+		}
+		release.Status.Details[prefix+node] = releaseapi.ReleaseDetailStatus{
+			Path:    node,
+			Reason:  "ImmutableFieldsChanged",
+			Message: strings.Join(msgs, "; "),
+		}
+	}
+}
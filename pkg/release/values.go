@@ -0,0 +1,164 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/render"
+	"github.com/caicloud/rudder/pkg/storage"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	gvkConfigMap = core.SchemeGroupVersion.WithKind("ConfigMap")
+	gvkSecret    = core.SchemeGroupVersion.WithKind("Secret")
+)
+
+// resolveValues resolves values layers of a release. It returns resolved layers
+// and their provenance in order. Missing optional references are skipped.
+func (rc *releaseContext) resolveValues(release *releaseapi.Release) ([]render.ValuesLayer, []storage.ValuesProvenance, error) {
+	sources, err := storage.ValuesLayers(release)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc.resolveLayers(release.Namespace, sources)
+}
+
+// rollbackValues returns the provenance of values layers of a version at present.
+// It's empty if the version doesn't exist, has no layers or can't be resolved.
+func (rc *releaseContext) rollbackValues(backend storage.ReleaseStorage, version int32) (string, error) {
+	history, err := backend.History(version)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	sources, err := storage.HistoryValuesLayers(history)
+	if err != nil || len(sources) <= 0 {
+		return "", nil
+	}
+	_, provenance, err := rc.resolveLayers(history.Namespace, sources)
+	if err != nil {
+		return "", nil
+	}
+	data, err := json.Marshal(provenance)
+	if err != nil {
+		return "", nil
+	}
+	return string(data), nil
+}
+
+// resolveLayers resolves values layers in namespace. It returns resolved layers
+// and their provenance in order.
+func (rc *releaseContext) resolveLayers(namespace string, sources []storage.ValuesLayerSource) ([]render.ValuesLayer, []storage.ValuesProvenance, error) {
+	layers := make([]render.ValuesLayer, 0, len(sources))
+	provenance := make([]storage.ValuesProvenance, 0, len(sources))
+	for _, source := range sources {
+		values, origin, err := rc.resolveLayer(namespace, &source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't resolve values layer %s: %v", source.Name, err)
+		}
+		p := storage.ValuesProvenance{
+			Name:   source.Name,
+			Source: origin,
+		}
+		if values != nil {
+			sum := sha256.Sum256([]byte(*values))
+			p.Digest = hex.EncodeToString(sum[:])
+			layers = append(layers, render.ValuesLayer{
+				Name:   source.Name,
+				Values: *values,
+				Secret: source.SecretKeyRef != nil,
+			})
+		}
+		provenance = append(provenance, p)
+	}
+	return layers, provenance, nil
+}
+
+// resolveLayer returns the content and origin of a layer. The content is nil if
+// the layer refers to a missing optional key.
+func (rc *releaseContext) resolveLayer(namespace string, source *storage.ValuesLayerSource) (*string, string, error) {
+	switch {
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		origin := fmt.Sprintf("configmap/%s/%s", ref.Name, ref.Key)
+		obj, err := rc.getObject(gvkConfigMap, namespace, ref.Name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, origin, err
+			}
+			return optionalKey(ref.Optional, origin, err)
+		}
+		cm := obj.(*core.ConfigMap)
+		if value, ok := cm.Data[ref.Key]; ok {
+			return &value, origin, nil
+		}
+		if value, ok := cm.BinaryData[ref.Key]; ok {
+			str := string(value)
+			return &str, origin, nil
+		}
+		return optionalKey(ref.Optional, origin, fmt.Errorf("no key %s in configmap %s", ref.Key, ref.Name))
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		origin := fmt.Sprintf("secret/%s/%s", ref.Name, ref.Key)
+		obj, err := rc.getObject(gvkSecret, namespace, ref.Name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return nil, origin, err
+			}
+			return optionalKey(ref.Optional, origin, err)
+		}
+		if value, ok := obj.(*core.Secret).Data[ref.Key]; ok {
+			str := string(value)
+			return &str, origin, nil
+		}
+		return optionalKey(ref.Optional, origin, fmt.Errorf("no key %s in secret %s", ref.Key, ref.Name))
+	case len(source.Values) > 0:
+		// Values may be a yaml string or a json object.
+		var str string
+		if err := json.Unmarshal(source.Values, &str); err != nil {
+			str = string(source.Values)
+		}
+		return &str, "inline", nil
+	}
+	return nil, "", fmt.Errorf("no source for values layer")
+}
+
+// valuesDigest returns a digest of resolved values layers of a release. An error
+// is also a digest, then the release can be applied to record the error.
+func (rc *releaseContext) valuesDigest(release *releaseapi.Release) string {
+	_, provenance, err := rc.resolveValues(release)
+	if err != nil {
+		return err.Error()
+	}
+	data, err := json.Marshal(provenance)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// getObject gets an object from cache layers.
+func (rc *releaseContext) getObject(gvk schema.GroupVersionKind, namespace, name string) (runtime.Object, error) {
+	layer, err := rc.layers.LayerFor(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return layer.ByNamespace(namespace).Get(name)
+}
+
+// optionalKey ignores err of a missing object or key if the reference is optional.
+func optionalKey(optional *bool, origin string, err error) (*string, string, error) {
+	if optional != nil && *optional {
+		return nil, origin, nil
+	}
+	return nil, origin, err
+}
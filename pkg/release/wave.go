@@ -0,0 +1,134 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/caicloud/rudder/pkg/render"
+	"github.com/caicloud/rudder/pkg/storage"
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/helm/pkg/releaseutil"
+)
+
+const (
+	// waveTimeout is the max duration to wait for resources of a wave to be ready.
+	waveTimeout = 10 * time.Minute
+	// waveInterval is the interval to check the status of a wave.
+	waveInterval = 2 * time.Second
+)
+
+// errSuperseded is returned when waiting for a wave or a hook, or applying
+// resources, is cancelled by a newer event of the release. The newer event is handled right after.
+var errSuperseded = errors.New("superseded by a newer event")
+
+// waveError is returned when resources of a wave are not ready.
+type waveError struct {
+	wave int
+	err  error
+}
+
+func (e *waveError) Error() string {
+	return fmt.Sprintf("wave %d is not ready: %v", e.wave, e.err)
+}
+
+// applyWaves applies resources of a carrier wave by wave. Before a wave is
+// applied, all resources in previous waves must be Running or Succeeded. The
+// current wave is recorded in release conditions. It returns conditions for
+// succeeded waves if there are more than one wave. Decisions for changes of
+// immutable fields are collected into decisions. Waiting for waves stops when
+// ctx is done, so newer events of the release are not blocked.
+func (rc *releaseContext) applyWaves(ctx context.Context, backend storage.ReleaseStorage, release *releaseapi.Release, carrier render.Carrier, decisions *immutableDecisions) ([]releaseapi.ReleaseCondition, error) {
+	resources := carrier.Resources()
+	// CRDs must be established before their instances are applied.
+	if err := rc.applyCRDs(release, resources); err != nil {
+		return nil, err
+	}
+	waves := render.WavesFor(resources)
+	if len(waves) <= 1 {
+		return nil, rc.applyResources(ctx, release, carrier, 0, decisions)
+	}
+	conditions := []releaseapi.ReleaseCondition{}
+	for i, wave := range waves {
+		glog.V(4).Infof("Apply wave %d for release %s/%s", wave, release.Namespace, release.Name)
+		condition := storage.Condition(storage.ReleaseReasonWaveApplying,
+			fmt.Sprintf("applying wave %d (%d/%d)", wave, i+1, len(waves)))
+		_, err := backend.Patch(func(rel *releaseapi.Release) {
+			rel.Status.Conditions = []releaseapi.ReleaseCondition{condition}
+		})
+		if err != nil {
+			return conditions, err
+		}
+		if err := rc.applyResources(ctx, release, carrier, wave, decisions); err != nil {
+			return conditions, err
+		}
+		if i < len(waves)-1 {
+			if err := rc.waitWave(ctx, release, resources, wave); err != nil {
+				if err == errSuperseded {
+					return conditions, err
+				}
+				return conditions, &waveError{wave, err}
+			}
+		}
+		conditions = append(conditions, storage.Condition(storage.ReleaseReasonWaveSucceeded,
+			fmt.Sprintf("wave %d succeeded", wave)))
+	}
+	return conditions, nil
+}
+
+// waitWave waits until all resources in wave are Running or Succeeded. It
+// returns errSuperseded if ctx is done before that.
+func (rc *releaseContext) waitWave(ctx context.Context, release *releaseapi.Release, resources []string, wave int) error {
+	members := make([]string, 0, len(resources))
+	gvks := make([]schema.GroupVersionKind, 0, len(resources))
+	for _, r := range resources {
+		if render.WaveOf(r) != wave {
+			continue
+		}
+		head := releaseutil.SimpleHead{}
+		if err := yaml.Unmarshal([]byte(r), &head); err != nil {
+			return err
+		}
+		members = append(members, r)
+		gvks = append(gvks, schema.FromAPIVersionAndKind(head.Version, head.Kind))
+	}
+	timeout, cancel := context.WithTimeout(ctx, waveTimeout)
+	defer cancel()
+	err := wait.PollImmediateUntil(waveInterval, func() (bool, error) {
+		objs, err := rc.client.Get(release.Namespace, members, kube.GetOptions{IgnoreNonexistence: true})
+		if err != nil {
+			return false, err
+		}
+		if len(objs) < len(members) {
+			return false, nil
+		}
+		for i, obj := range objs {
+			// Objects from cache have no gvk.
+			obj.GetObjectKind().SetGroupVersionKind(gvks[i])
+			status, err := rc.umpire.Judge(obj)
+			if err != nil {
+				// Kinds without an assistant are ready once they exist.
+				glog.V(4).Infof("Can't judge %s for release %s/%s: %v", gvks[i].Kind, release.Namespace, release.Name, err)
+				continue
+			}
+			switch status.Phase {
+			case releaseapi.ResourceRunning, releaseapi.ResourceSucceeded:
+			case releaseapi.ResourceFailed:
+				return false, fmt.Errorf("%s is failed: %s", gvks[i].Kind, status.Message)
+			default:
+				return false, nil
+			}
+		}
+		return true, nil
+	}, timeout.Done())
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return errSuperseded
+	}
+	return err
+}
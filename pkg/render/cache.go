@@ -0,0 +1,149 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	lru "github.com/hashicorp/golang-lru"
+	"k8s.io/helm/pkg/chartutil"
+	chartapi "k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// Cache caches loaded charts and render results. It's safe to share a cache
+// between renders in different goroutines.
+type Cache struct {
+	charts  *lru.Cache
+	results *lru.Cache
+
+	chartHits      uint64
+	chartMisses    uint64
+	chartEvictions uint64
+	resultHits     uint64
+	resultMisses   uint64
+}
+
+// CacheStats contains counters of a cache.
+type CacheStats struct {
+	// Charts is the number of cached charts.
+	Charts int `json:"charts"`
+	// ChartHits is the number of charts loaded from cache.
+	ChartHits uint64 `json:"chartHits"`
+	// ChartMisses is the number of charts loaded from templates.
+	ChartMisses uint64 `json:"chartMisses"`
+	// ChartEvictions is the number of charts evicted from cache.
+	ChartEvictions uint64 `json:"chartEvictions"`
+	// Results is the number of cached render results.
+	Results int `json:"results"`
+	// ResultHits is the number of renders which hit cache.
+	ResultHits uint64 `json:"resultHits"`
+	// ResultMisses is the number of renders which missed cache.
+	ResultMisses uint64 `json:"resultMisses"`
+}
+
+// NewCache creates a cache which keeps at most chartSize charts and resultSize
+// render results. Render results are not cached if resultSize is 0.
+func NewCache(chartSize, resultSize int) (*Cache, error) {
+	c := &Cache{}
+	var err error
+	c.charts, err = lru.NewWithEvict(chartSize, func(key interface{}, value interface{}) {
+		atomic.AddUint64(&c.chartEvictions, 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resultSize > 0 {
+		c.results, err = lru.New(resultSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Stats returns counters of the cache.
+func (c *Cache) Stats() CacheStats {
+	stats := CacheStats{
+		Charts:         c.charts.Len(),
+		ChartHits:      atomic.LoadUint64(&c.chartHits),
+		ChartMisses:    atomic.LoadUint64(&c.chartMisses),
+		ChartEvictions: atomic.LoadUint64(&c.chartEvictions),
+		ResultHits:     atomic.LoadUint64(&c.resultHits),
+		ResultMisses:   atomic.LoadUint64(&c.resultMisses),
+	}
+	if c.results != nil {
+		stats.Results = c.results.Len()
+	}
+	return stats
+}
+
+// chart returns a chart for template. Renders modify charts, so the result is
+// always a copy of the cached one.
+func (c *Cache) chart(digest string, template []byte) (*chartapi.Chart, error) {
+	if value, ok := c.charts.Get(digest); ok {
+		atomic.AddUint64(&c.chartHits, 1)
+		return proto.Clone(value.(*chartapi.Chart)).(*chartapi.Chart), nil
+	}
+	atomic.AddUint64(&c.chartMisses, 1)
+	chart, err := chartutil.LoadArchive(bytes.NewReader(template))
+	if err != nil {
+		return nil, err
+	}
+	c.charts.Add(digest, proto.Clone(chart))
+	return chart, nil
+}
+
+// result returns a cached carrier for key.
+func (c *Cache) result(key string) (Carrier, bool) {
+	if c.results == nil {
+		return nil, false
+	}
+	if value, ok := c.results.Get(key); ok {
+		atomic.AddUint64(&c.resultHits, 1)
+		return value.(Carrier), true
+	}
+	atomic.AddUint64(&c.resultMisses, 1)
+	return nil, false
+}
+
+// setResult caches a carrier for key.
+func (c *Cache) setResult(key string, carrier Carrier) {
+	if c.results != nil {
+		c.results.Add(key, carrier)
+	}
+}
+
+// digestOf returns the sha256 digest of template.
+func digestOf(template []byte) string {
+	sum := sha256.Sum256(template)
+	return hex.EncodeToString(sum[:])
+}
+
+// resultKey returns a key for render result. It contains all options which
+// affect the result.
+func resultKey(digest string, options *Options, caps *chartutil.Capabilities) (string, error) {
+	versions := make([]string, 0, len(caps.APIVersions))
+	for v := range caps.APIVersions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	kubeVersion := ""
+	if caps.KubeVersion != nil {
+		kubeVersion = caps.KubeVersion.String()
+	}
+	suspend := options.Suspend != nil && *options.Suspend
+	data, err := json.Marshal([]interface{}{
+		digest, options.Namespace, options.Release, options.Version,
+		options.Config, options.Layers, suspend, options.Time.UnixNano(),
+		kubeVersion, versions, options.Patches,
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't generate cache key: %v", err)
+	}
+	return digestOf(data), nil
+}
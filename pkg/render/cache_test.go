@@ -0,0 +1,198 @@
+package render
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// templatesFor builds count different chart archives in dir.
+func templatesFor(dir string, count int) ([][]byte, error) {
+	templates := make([][]byte, count)
+	for i := range templates {
+		sub, err := ioutil.TempDir(dir, "chart")
+		if err != nil {
+			return nil, err
+		}
+		templates[i], err = chartFor(sub, map[string][]string{
+			"app/templates/cm.yaml": {fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: cm-%d", i)},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+func TestCacheCharts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	templates, err := templatesFor(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewCache(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		// template is the index of template to load.
+		template int
+		expected CacheStats
+	}{
+		{0, CacheStats{Charts: 1, ChartMisses: 1}},
+		{1, CacheStats{Charts: 2, ChartMisses: 2}},
+		{0, CacheStats{Charts: 2, ChartHits: 1, ChartMisses: 2}},
+		// 1 is the least recently used one.
+		{2, CacheStats{Charts: 2, ChartHits: 1, ChartMisses: 3, ChartEvictions: 1}},
+		{0, CacheStats{Charts: 2, ChartHits: 2, ChartMisses: 3, ChartEvictions: 1}},
+		{1, CacheStats{Charts: 2, ChartHits: 2, ChartMisses: 4, ChartEvictions: 2}},
+	}
+	for i, step := range steps {
+		template := templates[step.template]
+		chart, err := cache.chart(digestOf(template), template)
+		if err != nil {
+			t.Fatalf("step %d: can't load chart: %v", i, err)
+		}
+		expected := fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: cm-%d", step.template)
+		if string(chart.Templates[0].Data) != expected {
+			t.Errorf("step %d: got template %q but expected %q", i, chart.Templates[0].Data, expected)
+		}
+		if stats := cache.Stats(); stats != step.expected {
+			t.Errorf("step %d: got stats %+v but expected %+v", i, stats, step.expected)
+		}
+	}
+}
+
+func TestCacheChartIsolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	templates, err := templatesFor(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewCache(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := digestOf(templates[0])
+	// Both the loaded chart and the cached chart must not be shared.
+	for i := 0; i < 3; i++ {
+		chart, err := cache.chart(digest, templates[0])
+		if err != nil {
+			t.Fatalf("round %d: can't load chart: %v", i, err)
+		}
+		if chart.Metadata.Name != "app" || len(chart.Templates) != 1 ||
+			string(chart.Templates[0].Data) != "kind: ConfigMap\nmetadata:\n  name: cm-0" {
+			t.Fatalf("round %d: cached chart is corrupted: %v", i, chart)
+		}
+		chart.Metadata.Name = "modified"
+		chart.Templates[0].Data = []byte("modified")
+		chart.Templates = append(chart.Templates, chart.Templates[0])
+	}
+}
+
+func TestCacheResults(t *testing.T) {
+	disabled, err := NewCache(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled.setResult("a", &treeCarrier{})
+	if _, ok := disabled.result("a"); ok {
+		t.Errorf("results are cached when result size is 0")
+	}
+	if stats := disabled.Stats(); stats != (CacheStats{}) {
+		t.Errorf("got stats %+v of a cache without results", stats)
+	}
+
+	cache, err := NewCache(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		// set is the key to cache before getting key.
+		set      string
+		key      string
+		hit      bool
+		expected CacheStats
+	}{
+		{"", "a", false, CacheStats{ResultMisses: 1}},
+		{"a", "a", true, CacheStats{Results: 1, ResultHits: 1, ResultMisses: 1}},
+		{"b", "b", true, CacheStats{Results: 2, ResultHits: 2, ResultMisses: 1}},
+		// a is the least recently used one.
+		{"c", "a", false, CacheStats{Results: 2, ResultHits: 2, ResultMisses: 2}},
+		{"", "b", true, CacheStats{Results: 2, ResultHits: 3, ResultMisses: 2}},
+	}
+	carriers := make(map[string]Carrier)
+	for i, step := range steps {
+		if step.set != "" {
+			carriers[step.set] = &treeCarrier{notes: step.set}
+			cache.setResult(step.set, carriers[step.set])
+		}
+		carrier, ok := cache.result(step.key)
+		if ok != step.hit {
+			t.Errorf("step %d: expected hit %v but got %v", i, step.hit, ok)
+		}
+		if ok && carrier != carriers[step.key] {
+			t.Errorf("step %d: got a different carrier for %s", i, step.key)
+		}
+		if stats := cache.Stats(); stats != step.expected {
+			t.Errorf("step %d: got stats %+v but expected %+v", i, stats, step.expected)
+		}
+	}
+}
+
+func TestRenderWithCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	templates, err := templatesFor(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewCache(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := NewRenderWithCache(cache)
+	renderTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		config   string
+		time     time.Time
+		expected CacheStats
+	}{
+		// Results rendered with current time are not cached.
+		{"{}", time.Time{}, CacheStats{Charts: 1, ChartMisses: 1}},
+		{"{}", renderTime, CacheStats{Charts: 1, ChartHits: 1, ChartMisses: 1, Results: 1, ResultMisses: 1}},
+		{"{}", renderTime, CacheStats{Charts: 1, ChartHits: 1, ChartMisses: 1, Results: 1, ResultHits: 1, ResultMisses: 1}},
+		{`{"a":1}`, renderTime, CacheStats{Charts: 1, ChartHits: 2, ChartMisses: 1, Results: 1, ResultHits: 1, ResultMisses: 2}},
+	}
+	for i, step := range steps {
+		carrier, err := render.Render(&Options{
+			Namespace: "default",
+			Release:   "app",
+			Template:  templates[0],
+			Config:    step.config,
+			Time:      step.time,
+		})
+		if err != nil {
+			t.Fatalf("step %d: can't render: %v", i, err)
+		}
+		if resources := carrier.Resources(); len(resources) != 1 {
+			t.Errorf("step %d: got resources %v", i, resources)
+		}
+		if stats := cache.Stats(); stats != step.expected {
+			t.Errorf("step %d: got stats %+v but expected %+v", i, stats, step.expected)
+		}
+	}
+}
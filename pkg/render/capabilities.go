@@ -0,0 +1,108 @@
+package render
+
+import (
+	"io/ioutil"
+
+	"github.com/caicloud/rudder/pkg/kube"
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+// DefaultKubeVersion is the kube version for templates if the version of the
+// cluster is unknown. It's the version of kubernetes libraries which rudder is
+// built with.
+var DefaultKubeVersion = version.Info{
+	Major:      "1",
+	Minor:      "14",
+	GitVersion: "v1.14.2",
+}
+
+// CapabilitiesSource provides the capabilities of a cluster for templates.
+type CapabilitiesSource interface {
+	// Capabilities returns the capabilities which are used as .Capabilities in templates.
+	Capabilities() *chartutil.Capabilities
+}
+
+// NewCapabilitiesSource creates a capabilities source from discovered api resources.
+// The source always reflects current resources and server version.
+func NewCapabilitiesSource(resources kube.APIResources) CapabilitiesSource {
+	return &resourcesCapabilities{
+		resources: resources,
+	}
+}
+
+type resourcesCapabilities struct {
+	resources kube.APIResources
+}
+
+// Capabilities returns the capabilities which are used as .Capabilities in templates.
+// All served group versions and group version kinds are in APIVersions. For example:
+//  v1
+//  v1/Service
+//  apps/v1
+//  apps/v1/Deployment
+func (rc *resourcesCapabilities) Capabilities() *chartutil.Capabilities {
+	versions := []string{}
+	for gvk := range rc.resources.Resources() {
+		gv := gvk.GroupVersion().String()
+		versions = append(versions, gv, gv+"/"+gvk.Kind)
+	}
+	caps := &chartutil.Capabilities{
+		APIVersions: chartutil.NewVersionSet(versions...),
+		KubeVersion: rc.resources.ServerVersion(),
+	}
+	if caps.KubeVersion == nil {
+		kubeVersion := DefaultKubeVersion
+		caps.KubeVersion = &kubeVersion
+	}
+	return caps
+}
+
+// StaticCapabilities describes the capabilities of a cluster in a file.
+// It's useful when there is no cluster to discover. A capabilities file
+// should like:
+//  kubeVersion:
+//    major: "1"
+//    minor: "13"
+//    gitVersion: v1.13.5
+//  apiVersions:
+//  - v1
+//  - apps/v1
+//  - apps/v1/Deployment
+type StaticCapabilities struct {
+	// KubeVersion is the version of api server.
+	KubeVersion *version.Info `json:"kubeVersion,omitempty"`
+	// APIVersions contains all available api versions.
+	APIVersions []string `json:"apiVersions,omitempty"`
+}
+
+// LoadCapabilities loads static capabilities from a yaml or json file.
+func LoadCapabilities(path string) (*StaticCapabilities, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	caps := &StaticCapabilities{}
+	if err := yaml.Unmarshal(data, caps); err != nil {
+		return nil, err
+	}
+	return caps, nil
+}
+
+// Capabilities returns the capabilities which are used as .Capabilities in templates.
+// DefaultKubeVersion is used if there is no kube version.
+func (sc *StaticCapabilities) Capabilities() *chartutil.Capabilities {
+	caps := &chartutil.Capabilities{
+		APIVersions: chartutil.NewVersionSet(sc.APIVersions...),
+		KubeVersion: sc.KubeVersion,
+	}
+	if len(sc.APIVersions) <= 0 {
+		caps.APIVersions = chartutil.DefaultVersionSet
+	}
+	if caps.KubeVersion == nil {
+		kubeVersion := DefaultKubeVersion
+		caps.KubeVersion = &kubeVersion
+	}
+	return caps
+}
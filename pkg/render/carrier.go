@@ -30,9 +30,17 @@ type Carrier interface {
 	// on the dependencies of nodes. If any error occurred, it will cancel all
 	// processes and return an error.
 	Run(ctx context.Context, order CarrierOrder, handler CarrierHandler) error
-	// Resources returns all resources.
+	// Resources returns all resources. The order is stable for the same
+	// resources: resources are ordered by the logic path of their nodes, then
+	// by template file, and then by index in the file. A node is ordered before
+	// its children.
 	Resources() []string
 	// ResourcesOf returns resources of a target. target is a path of resource node.
 	// If there is no node for target, it returns an error.
 	ResourcesOf(target string) ([]string, error)
+	// Hooks returns all hooks. Hooks are not included in Resources().
+	Hooks() []*Hook
+	// Notes returns rendered NOTES.txt of the top-level chart. It's empty if the
+	// chart has no notes. Notes of subcharts are dropped.
+	Notes() string
 }
@@ -0,0 +1,249 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+// DependsOnAnno is the annotation key of node dependencies. A resource of a
+// subchart can declare that its subchart depends on sibling subcharts. The value
+// is a comma separated list of sibling names. For example, resources in
+// a/charts/web can declare:
+//  release.caicloud.io/depends-on: db,cache
+// Then a/db and a/cache are executed before a/web in positive order, and after
+// a/web in reversed order. Declarations of all resources in a node are merged.
+// Chart.yaml has no field for custom metadata, so dependencies are declared
+// by resources and kept in release manifests.
+const DependsOnAnno = "release.caicloud.io/depends-on"
+
+// dagCarrier is a carrier which executes nodes by the chart tree and extra
+// dependencies between sibling nodes.
+type dagCarrier struct {
+	*treeCarrier
+	// dependencies is a map from node paths to paths of their dependencies. All
+	// dependencies are nodes in the tree.
+	dependencies map[string][]string
+}
+
+// carrierWithDependencies returns a dagCarrier if any node of tc declares
+// dependencies. Otherwise tc is returned. charts contains paths of all charts
+// in the chart tree, including subcharts disabled by conditions or tags. Charts
+// without any resources have no node, so dependencies on them are ignored. A
+// dependency on a chart which is not in charts is an error. If charts is nil,
+// the chart tree is unknown and all dependencies without nodes are ignored.
+func carrierWithDependencies(tc *treeCarrier, charts map[string]bool) (Carrier, error) {
+	if tc.root == nil {
+		return tc, nil
+	}
+	nodes := make(map[string]bool)
+	tc.root.walkthrough(func(n *node) bool {
+		nodes[n.path] = true
+		return true
+	})
+	dependencies := make(map[string][]string)
+	var err error
+	tc.root.walkthrough(func(n *node) bool {
+		var deps []string
+		deps, err = n.dependencies()
+		if err != nil {
+			return false
+		}
+		existing := make([]string, 0, len(deps))
+		for _, dep := range deps {
+			switch {
+			case nodes[dep]:
+				existing = append(existing, dep)
+			case charts != nil && !charts[dep]:
+				err = &RenderError{Phase: RenderPhaseCarrier, Resource: -1,
+					Message: fmt.Sprintf("chart %s depends on a nonexistent chart %s", n.path, dep)}
+				return false
+			}
+		}
+		if len(existing) > 0 {
+			dependencies[n.path] = existing
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(dependencies) <= 0 {
+		return tc, nil
+	}
+	dc := &dagCarrier{
+		treeCarrier:  tc,
+		dependencies: dependencies,
+	}
+	if err := dc.checkCycle(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// dependencies returns paths of sibling nodes which n depends on. It checks that
+// all dependencies exist.
+func (n *node) dependencies() ([]string, error) {
+	set := make(map[string]bool)
+	for _, r := range n.resources {
+		res := resource{}
+		if err := yaml.Unmarshal([]byte(r), &res); err != nil {
+			return nil, &RenderError{Phase: RenderPhaseCarrier, Resource: -1, Message: err.Error()}
+		}
+		for _, name := range splitAnnotation(res.Metadata.Annotations[DependsOnAnno]) {
+			set[name] = true
+		}
+	}
+	if len(set) <= 0 {
+		return nil, nil
+	}
+	parent := path.Dir(n.path)
+	if parent == "." {
+		return nil, &RenderError{Phase: RenderPhaseCarrier, Resource: -1,
+			Message: fmt.Sprintf("top-level chart %s can't depend on other charts", n.path)}
+	}
+	deps := make([]string, 0, len(set))
+	for name := range set {
+		if name == n.name {
+			return nil, &RenderError{Phase: RenderPhaseCarrier, Resource: -1,
+				Message: fmt.Sprintf("chart %s depends on itself", n.path)}
+		}
+		deps = append(deps, parent+"/"+name)
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// prerequisites returns a map from node paths to paths of nodes which must be
+// executed before them in order.
+func (dc *dagCarrier) prerequisites(order CarrierOrder) (map[string]*node, map[string][]string, error) {
+	nodes := make(map[string]*node)
+	paths := make([]string, 0)
+	dc.root.walkthrough(func(n *node) bool {
+		nodes[n.path] = n
+		paths = append(paths, n.path)
+		return true
+	})
+	// edges are in positive order. A node must be executed after its children
+	// and its dependencies.
+	edges := make(map[string][]string)
+	for _, p := range paths {
+		n := nodes[p]
+		for _, child := range n.sortedChildren() {
+			edges[p] = append(edges[p], child.path)
+		}
+		edges[p] = append(edges[p], dc.dependencies[p]...)
+	}
+	switch order {
+	case PositiveOrder:
+		return nodes, edges, nil
+	case ReversedOrder:
+		reversed := make(map[string][]string)
+		for _, p := range paths {
+			for _, q := range edges[p] {
+				reversed[q] = append(reversed[q], p)
+			}
+		}
+		return nodes, reversed, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown order: %s", order)
+	}
+}
+
+// checkCycle checks if there is a cycle in nodes.
+func (dc *dagCarrier) checkCycle() error {
+	_, edges, err := dc.prerequisites(PositiveOrder)
+	if err != nil {
+		return err
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := make(map[string]int)
+	var visit func(p string, trace []string) error
+	visit = func(p string, trace []string) error {
+		trace = append(trace, p)
+		switch states[p] {
+		case visiting:
+			return &RenderError{Phase: RenderPhaseCarrier, Resource: -1,
+				Message: fmt.Sprintf("dependency cycle: %s", strings.Join(trace, " -> "))}
+		case visited:
+			return nil
+		}
+		states[p] = visiting
+		for _, q := range edges[p] {
+			if err := visit(q, trace); err != nil {
+				return err
+			}
+		}
+		states[p] = visited
+		return nil
+	}
+	paths := make([]string, 0, len(edges))
+	for p := range edges {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if err := visit(p, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run executes all resources via handler. A node is executed after all its
+// prerequisites succeeded. Independent nodes are executed in parallel. If a
+// node failed, nodes which wait for it are not executed.
+func (dc *dagCarrier) Run(ctx context.Context, order CarrierOrder, handler CarrierHandler) error {
+	nodes, prerequisites, err := dc.prerequisites(order)
+	if err != nil {
+		return err
+	}
+	type state struct {
+		done   chan struct{}
+		failed bool
+	}
+	states := make(map[string]*state, len(nodes))
+	for p := range nodes {
+		states[p] = &state{done: make(chan struct{})}
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(len(nodes))
+	errSync := &sync.Mutex{}
+	errList := make([]error, 0)
+	for p, n := range nodes {
+		go func(p string, n *node) {
+			defer wg.Done()
+			s := states[p]
+			defer close(s.done)
+			for _, q := range prerequisites[p] {
+				<-states[q].done
+				if states[q].failed {
+					s.failed = true
+				}
+			}
+			if s.failed {
+				return
+			}
+			if err := n.handle(ctx, handler); err != nil {
+				s.failed = true
+				errSync.Lock()
+				errList = append(errList, err)
+				errSync.Unlock()
+			}
+		}(p, n)
+	}
+	wg.Wait()
+	if len(errList) > 0 {
+		return errors.NewAggregate(errList)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/any"
+	"k8s.io/helm/pkg/chartutil"
+	chartapi "k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// resourceWithDependencies returns a resource which declares dependencies of
+// its chart.
+func resourceWithDependencies(name, deps string) string {
+	if deps == "" {
+		return fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: %s", name)
+	}
+	return fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: %s\n  annotations:\n    %s: %s", name, DependsOnAnno, deps)
+}
+
+// filesWithDependencies returns a file-resources map. deps is a map from chart
+// paths to their dependencies. The top-level chart is app.
+func filesWithDependencies(deps map[string]string) map[string][]string {
+	files := make(map[string][]string)
+	for chart, dep := range deps {
+		file := strings.Replace(chart, "/", "/charts/", -1) + "/templates/cm.yaml"
+		files[file] = []string{resourceWithDependencies(strings.Replace(chart, "/", "-", -1), dep)}
+	}
+	return files
+}
+
+func TestCarrierWithDependencies(t *testing.T) {
+	testCases := []struct {
+		name   string
+		deps   map[string]string
+		charts []string
+		// before are pairs of nodes. The first node is executed before the
+		// second one in PositiveOrder, and after it in ReversedOrder.
+		before [][2]string
+		err    string
+	}{
+		{
+			"tree",
+			map[string]string{"app": "", "app/web": "", "app/web/db": ""},
+			nil,
+			[][2]string{{"app/web/db", "app/web"}, {"app/web", "app"}},
+			"",
+		},
+		{
+			"siblings",
+			map[string]string{"app": "", "app/web": "db,cache", "app/cache": "db", "app/db": ""},
+			nil,
+			[][2]string{{"app/db", "app/cache"}, {"app/cache", "app/web"}, {"app/db", "app/web"}, {"app/web", "app"}},
+			"",
+		},
+		{
+			"nested siblings",
+			map[string]string{"app": "", "app/web": "", "app/web/api": "store", "app/web/store": "", "app/db": ""},
+			nil,
+			[][2]string{{"app/web/store", "app/web/api"}, {"app/web/api", "app/web"}, {"app/web", "app"}, {"app/db", "app"}},
+			"",
+		},
+		{
+			"disabled chart",
+			map[string]string{"app": "", "app/web": "db,cache", "app/db": ""},
+			[]string{"app", "app/web", "app/db", "app/cache"},
+			[][2]string{{"app/db", "app/web"}, {"app/web", "app"}},
+			"",
+		},
+		{
+			"unknown chart tree",
+			map[string]string{"app": "", "app/web": "db,cache", "app/db": ""},
+			nil,
+			[][2]string{{"app/db", "app/web"}},
+			"",
+		},
+		{
+			"nonexistent chart",
+			map[string]string{"app": "", "app/web": "db,cache", "app/db": ""},
+			[]string{"app", "app/web", "app/db"},
+			nil,
+			"chart app/web depends on a nonexistent chart app/cache",
+		},
+		{
+			"self dependency",
+			map[string]string{"app": "", "app/web": "web"},
+			nil,
+			nil,
+			"chart app/web depends on itself",
+		},
+		{
+			"top-level dependency",
+			map[string]string{"app": "web", "app/web": ""},
+			nil,
+			nil,
+			"top-level chart app can't depend on other charts",
+		},
+		{
+			"cycle",
+			map[string]string{"app": "", "app/web": "db", "app/db": "web"},
+			nil,
+			nil,
+			"dependency cycle: app -> app/db -> app/web -> app/db",
+		},
+		{
+			"indirect cycle",
+			map[string]string{"app": "", "app/web": "db", "app/db": "cache", "app/cache": "web"},
+			nil,
+			nil,
+			"dependency cycle: app -> app/cache -> app/web -> app/db -> app/cache",
+		},
+	}
+	for _, tc := range testCases {
+		tree, err := treeCarrierFor(filesWithDependencies(tc.deps))
+		if err != nil {
+			t.Errorf("%s: can't create tree carrier: %v", tc.name, err)
+			continue
+		}
+		var charts map[string]bool
+		if tc.charts != nil {
+			charts = make(map[string]bool)
+			for _, c := range tc.charts {
+				charts[c] = true
+			}
+		}
+		carrier, err := carrierWithDependencies(tree, charts)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expected error %q but got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: can't create carrier: %v", tc.name, err)
+			continue
+		}
+		for _, order := range []CarrierOrder{PositiveOrder, ReversedOrder} {
+			// Run several times because siblings are executed in parallel.
+			for i := 0; i < 10; i++ {
+				lock := sync.Mutex{}
+				positions := make(map[string]int)
+				err := carrier.Run(context.Background(), order, func(ctx context.Context, node string, resources []string) error {
+					lock.Lock()
+					defer lock.Unlock()
+					positions[node] = len(positions)
+					return nil
+				})
+				if err != nil {
+					t.Errorf("%s: can't run carrier in %s: %v", tc.name, order, err)
+					break
+				}
+				if len(positions) != len(tc.deps) {
+					t.Errorf("%s: executed nodes %v in %s but expected %d nodes", tc.name, positions, order, len(tc.deps))
+					break
+				}
+				for _, pair := range tc.before {
+					first, second := pair[0], pair[1]
+					if order == ReversedOrder {
+						first, second = second, first
+					}
+					if positions[first] > positions[second] {
+						t.Errorf("%s: %s is executed after %s in %s", tc.name, first, second, order)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRenderDependsOnDisabledChart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chart := &chartapi.Chart{
+		Metadata: &chartapi.Metadata{Name: "app", Version: "0.1.0"},
+		Files: []*any.Any{{
+			TypeUrl: "requirements.yaml",
+			Value: []byte("dependencies:\n" +
+				"- name: web\n  version: 0.1.0\n" +
+				"- name: cache\n  version: 0.1.0\n  condition: cache.enabled\n"),
+		}},
+	}
+	for name, deps := range map[string]string{"web": "cache", "cache": ""} {
+		chart.Dependencies = append(chart.Dependencies, &chartapi.Chart{
+			Metadata: &chartapi.Metadata{Name: name, Version: "0.1.0"},
+			Templates: []*chartapi.Template{{
+				Name: "templates/cm.yaml",
+				Data: []byte(resourceWithDependencies(name, deps)),
+			}},
+		})
+	}
+	name, err := chartutil.Save(chart, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name      string
+		config    string
+		resources int
+	}{
+		{"enabled", `{"cache":{"enabled":true}}`, 2},
+		{"disabled", `{"cache":{"enabled":false}}`, 1},
+	}
+	for _, tc := range testCases {
+		carrier, err := NewRender().Render(&Options{
+			Namespace: "default",
+			Release:   "app",
+			Template:  template,
+			Config:    tc.config,
+		})
+		if err != nil {
+			t.Errorf("%s: can't render chart: %v", tc.name, err)
+			continue
+		}
+		if got := len(carrier.Resources()); got != tc.resources {
+			t.Errorf("%s: got %d resources but expected %d", tc.name, got, tc.resources)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/helm/pkg/chartutil"
+	helmengine "k8s.io/helm/pkg/engine"
+	chartapi "k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/releaseutil"
+)
+
+// engine renders templates of a chart like the helm engine does. The helm engine
+// annotates documents of a file in random order, so the rendering is done here
+// to keep documents in the order which templates produce them.
+type engine struct {
+	// funcMap contains functions for templates except late-bound ones.
+	funcMap template.FuncMap
+}
+
+// newEngine creates an engine with functions of the helm engine.
+func newEngine() *engine {
+	return &engine{
+		funcMap: helmengine.FuncMap(),
+	}
+}
+
+// renderable is a template to render.
+type renderable struct {
+	// tpl is the content of template.
+	tpl string
+	// path is the path of the chart which the template belongs to.
+	path string
+	// vals are the values of the template.
+	vals chartutil.Values
+	// basePath is the namespace of templates of the chart.
+	basePath string
+}
+
+// Render renders all templates of a chart and its dependencies. It returns a
+// file-content map. Each document is annotated with the namespace, the release
+// name and the path of its chart.
+func (e *engine) Render(chart *chartapi.Chart, values chartutil.Values) (map[string]string, error) {
+	templates := map[string]renderable{}
+	allTemplates(chart, templates, values, true, "", "")
+	return e.render(templates, templates)
+}
+
+// alterFuncMap adds late-bound functions to the func map for t. all are the
+// templates which the tpl function can refer to.
+func (e *engine) alterFuncMap(t *template.Template, all map[string]renderable) template.FuncMap {
+	funcMap := template.FuncMap{}
+	for k, v := range e.funcMap {
+		funcMap[k] = v
+	}
+	funcMap["include"] = func(name string, data interface{}) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		if err := t.ExecuteTemplate(buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	funcMap["required"] = func(warn string, val interface{}) (interface{}, error) {
+		if val == nil {
+			return val, errors.New(warn)
+		} else if _, ok := val.(string); ok {
+			if val == "" {
+				return val, errors.New(warn)
+			}
+		}
+		return val, nil
+	}
+	funcMap["tpl"] = func(tpl string, vals chartutil.Values) (string, error) {
+		templates := map[string]renderable{
+			"aaa_template": {tpl: tpl, vals: vals},
+		}
+		result, err := e.render(templates, all)
+		if err != nil {
+			return "", fmt.Errorf("Error during tpl function execution for %q: %s", tpl, err.Error())
+		}
+		return result["aaa_template"], nil
+	}
+	return funcMap
+}
+
+// render renders tpls. Templates in all can be included by tpls. Errors have the
+// same format as errors of the helm engine.
+func (e *engine) render(tpls map[string]renderable, all map[string]renderable) (map[string]string, error) {
+	t := template.New("gotpl")
+	// Zero values are emitted for missing keys. "<no value>" is removed later.
+	t.Option("missingkey=zero")
+	funcMap := e.alterFuncMap(t, all)
+
+	// Parse templates in the order of the helm engine. Nested templates are
+	// parsed first, so definitions in higher-level templates take precedence.
+	keys := make([]string, 0, len(tpls))
+	for key := range tpls {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		ca, cb := strings.Count(a, "/"), strings.Count(b, "/")
+		if ca == cb {
+			return a > b
+		}
+		return ca > cb
+	})
+	files := make([]string, 0, len(keys))
+	for _, name := range keys {
+		t = t.New(name).Funcs(funcMap)
+		if _, err := t.Parse(tpls[name].tpl); err != nil {
+			return map[string]string{}, fmt.Errorf("parse error in %q: %s", name, err)
+		}
+		files = append(files, name)
+	}
+	// Templates of the chart can be referred by the tpl function.
+	for name, r := range all {
+		if t.Lookup(name) == nil {
+			t = t.New(name).Funcs(funcMap)
+			if _, err := t.Parse(r.tpl); err != nil {
+				return map[string]string{}, fmt.Errorf("parse error in %q: %s", name, err)
+			}
+		}
+	}
+
+	rendered := make(map[string]string, len(files))
+	var buf bytes.Buffer
+	for _, file := range files {
+		// Partials are only included by other templates.
+		if strings.HasPrefix(path.Base(file), "_") {
+			continue
+		}
+		tpl := tpls[file]
+		vals := tpl.vals
+		vals["Template"] = map[string]interface{}{"Name": file, "BasePath": tpl.basePath}
+		if err := t.ExecuteTemplate(&buf, file, vals); err != nil {
+			return map[string]string{}, fmt.Errorf("render error in %q: %s", file, err)
+		}
+		data := strings.Replace(buf.String(), "<no value>", "", -1)
+		rendered[file] = annotate(data, &tpl)
+		buf.Reset()
+	}
+	return rendered, nil
+}
+
+// annotate adds the namespace, the release name and the chart path to all
+// documents of a rendered file. Documents are kept in order.
+func annotate(data string, r *renderable) string {
+	annos := make(map[releaseutil.AnnotationKey]string)
+	if release, ok := r.vals["Release"].(map[string]interface{}); ok {
+		if value, ok := release["Namespace"]; ok {
+			annos[releaseutil.DefaultNamespaceKey] = fmt.Sprint(value)
+		}
+		if value, ok := release["Name"]; ok {
+			annos[releaseutil.DefaultReleaseKey] = fmt.Sprint(value)
+		}
+	}
+	annos[releaseutil.DefaultPathKey] = r.path
+	docs := releaseutil.SplitManifests(data)
+	result := make([]string, 0, len(docs))
+	for _, name := range manifestNames(docs) {
+		result = append(result, releaseutil.InjectAnnotations(docs[name], annos))
+	}
+	return strings.Join(result, "\n---\n")
+}
+
+// allTemplates collects templates of a chart and its dependencies into
+// templates. Values are scoped for templates of each chart.
+func allTemplates(c *chartapi.Chart, templates map[string]renderable, parentVals chartutil.Values, top bool, parentPath string, parentID string) {
+	cvals := chartutil.Values{}
+	if top {
+		// Values of the top-level chart are authoritative.
+		cvals = parentVals
+	} else if c.Metadata != nil && c.Metadata.Name != "" {
+		newVals := chartutil.Values{}
+		if vs, err := parentVals.Table("Values"); err == nil {
+			if tmp, err := vs.Table(c.Metadata.Name); err == nil {
+				newVals = tmp
+			}
+		}
+		cvals = map[string]interface{}{
+			"Values":       newVals,
+			"Release":      parentVals["Release"],
+			"Chart":        c.Metadata,
+			"Files":        chartutil.NewFiles(c.Files),
+			"Capabilities": parentVals["Capabilities"],
+		}
+	}
+
+	newParentID := c.Metadata.Name
+	parentPath = path.Join(parentPath, newParentID)
+	if parentID != "" {
+		// Templates of dependencies are namespaced by the path of their charts.
+		newParentID = path.Join(parentID, "charts", newParentID)
+	}
+	for _, child := range c.Dependencies {
+		allTemplates(child, templates, cvals, false, parentPath, newParentID)
+	}
+	for _, t := range c.Templates {
+		templates[path.Join(newParentID, t.Name)] = renderable{
+			tpl:      string(t.Data),
+			path:     parentPath,
+			vals:     cvals,
+			basePath: path.Join(newParentID, "templates"),
+		}
+	}
+}
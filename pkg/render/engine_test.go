@@ -0,0 +1,77 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/helm/pkg/chartutil"
+	chartapi "k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// nameRegexp matches names of rendered resources.
+var nameRegexp = regexp.MustCompile(`(?m)^  name: (\S+)$`)
+
+func TestEngineRender(t *testing.T) {
+	testCases := []struct {
+		name      string
+		templates map[string]string
+		names     []string
+		err       string
+	}{
+		{
+			"documents in order",
+			map[string]string{
+				"templates/cm.yaml": "{{- range $i := until 12 }}\n---\nkind: ConfigMap\nmetadata:\n  name: cm-{{ $i }}\n{{- end }}",
+			},
+			[]string{"cm-0", "cm-1", "cm-2", "cm-3", "cm-4", "cm-5", "cm-6", "cm-7", "cm-8", "cm-9", "cm-10", "cm-11"},
+			"",
+		},
+		{
+			"include and tpl",
+			map[string]string{
+				"templates/_helpers.tpl": `{{ define "app.name" }}{{ .Chart.Name }}-{{ .Values.suffix }}{{ end }}`,
+				"templates/cm.yaml":      "kind: ConfigMap\nmetadata:\n  name: {{ include \"app.name\" . }}\n---\nkind: ConfigMap\nmetadata:\n  name: {{ tpl \"{{ .Values.suffix }}\" . }}",
+			},
+			[]string{"app-web", "web"},
+			"",
+		},
+		{
+			"required values",
+			map[string]string{
+				"templates/cm.yaml": `{{ required "image is required" .Values.image }}`,
+			},
+			nil,
+			"image is required",
+		},
+	}
+	for _, tc := range testCases {
+		chart := &chartapi.Chart{Metadata: &chartapi.Metadata{Name: "app"}}
+		for name, data := range tc.templates {
+			chart.Templates = append(chart.Templates, &chartapi.Template{Name: name, Data: []byte(data)})
+		}
+		values := chartutil.Values{
+			"Values":  chartutil.Values{"suffix": "web"},
+			"Chart":   chart.Metadata,
+			"Release": map[string]interface{}{"Name": "app", "Namespace": "default"},
+		}
+		files, err := newEngine().Render(chart, values)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: expected error %q but got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: can't render: %v", tc.name, err)
+			continue
+		}
+		names := []string{}
+		for _, match := range nameRegexp.FindAllStringSubmatch(files["app/templates/cm.yaml"], -1) {
+			names = append(names, match[1])
+		}
+		if strings.Join(names, ",") != strings.Join(tc.names, ",") {
+			t.Errorf("%s: got resources %v but expected %v", tc.name, names, tc.names)
+		}
+	}
+}
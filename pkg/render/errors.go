@@ -0,0 +1,136 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RenderPhase is the phase where a render error occurred.
+type RenderPhase string
+
+const (
+	// RenderPhaseTemplate means that a template can't be parsed or executed.
+	RenderPhaseTemplate RenderPhase = "Template"
+	// RenderPhaseParse means that a rendered resource isn't a valid yaml.
+	RenderPhaseParse RenderPhase = "Parse"
+	// RenderPhasePatch means that a patch can't be applied to a resource.
+	RenderPhasePatch RenderPhase = "Patch"
+	// RenderPhaseCarrier means that resources can't be organized by a carrier.
+	RenderPhaseCarrier RenderPhase = "Carrier"
+)
+
+// RenderError describes where an error occurred when rendering a chart.
+// Unknown fields are left empty.
+type RenderError struct {
+	// Phase is the phase where the error occurred.
+	Phase RenderPhase `json:"phase"`
+	// File is the template file. For example: a/charts/b/templates/deployment.yaml
+	File string `json:"file,omitempty"`
+	// Line is the line in File. It starts from 1.
+	Line int `json:"line,omitempty"`
+	// Column is the column in Line. It starts from 1.
+	Column int `json:"column,omitempty"`
+	// Resource is the index of resource in File. It starts from 0 and is -1
+	// if unknown.
+	Resource int `json:"resource"`
+	// ValuePath is the value which a template failed to evaluate.
+	// For example: .Values.image.tag
+	ValuePath string `json:"valuePath,omitempty"`
+	// Message describes the error.
+	Message string `json:"message"`
+}
+
+// Error returns the error in one line. For example:
+//  Template error in a/templates/deployment.yaml:12:20 at <.Values.image.tag>: nil pointer evaluating interface {}.tag
+func (e *RenderError) Error() string {
+	location := e.File
+	if location != "" && e.Line > 0 {
+		location += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			location += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	msg := string(e.Phase) + " error"
+	if location != "" {
+		msg += " in " + location
+	}
+	if e.Resource >= 0 {
+		msg += fmt.Sprintf(" (resource %d)", e.Resource)
+	}
+	if e.ValuePath != "" {
+		msg += " at <" + e.ValuePath + ">"
+	}
+	return msg + ": " + e.Message
+}
+
+var (
+	// engineErrorPattern matches errors from helm engine:
+	//  render error in "a/templates/x.yaml": template: ...
+	//  parse error in "a/templates/x.yaml": template: ...
+	engineErrorPattern = regexp.MustCompile(`^(?:render|parse) error in "([^"]+)": (.*)$`)
+	// templateErrorPattern matches errors from text/template:
+	//  template: a/templates/x.yaml:12:20: executing "a/templates/x.yaml" at <.Values.a>: message
+	//  template: a/templates/x.yaml:12: unexpected "}" in operand
+	templateErrorPattern = regexp.MustCompile(`^template: ([^:]+):(\d+)(?::(\d+))?: (.*)$`)
+	// executingPattern matches execution details of text/template errors.
+	executingPattern = regexp.MustCompile(`^executing "[^"]*" at <([^>]*)>: (.*)$`)
+	// yamlLinePattern matches line numbers of yaml errors.
+	yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+)
+
+// templateError converts an error of helm engine to a RenderError.
+func templateError(err error) *RenderError {
+	re := &RenderError{
+		Phase:    RenderPhaseTemplate,
+		Resource: -1,
+		Message:  err.Error(),
+	}
+	msg := re.Message
+	if m := engineErrorPattern.FindStringSubmatch(msg); m != nil {
+		re.File, msg = m[1], m[2]
+		re.Message = msg
+	}
+	if m := templateErrorPattern.FindStringSubmatch(msg); m != nil {
+		// The error may come from an included template. Then the file is
+		// where the included template is defined.
+		re.File = m[1]
+		re.Line, _ = strconv.Atoi(m[2])
+		re.Column, _ = strconv.Atoi(m[3])
+		re.Message = m[4]
+	}
+	if m := executingPattern.FindStringSubmatch(re.Message); m != nil {
+		re.ValuePath, re.Message = m[1], m[2]
+	}
+	return re
+}
+
+// manifestIndex returns the index of a resource from releaseutil.SplitManifests.
+// The name of resource should like: manifest-1
+func manifestIndex(name string) int {
+	index := -1
+	if _, err := fmt.Sscanf(name, "manifest-%d", &index); err != nil {
+		return -1
+	}
+	return index
+}
+
+// parseError creates a RenderError for a resource which can't be parsed. content
+// is the content of file. The line of error is calculated if possible.
+func parseError(file, content string, index int, resource string, err error) *RenderError {
+	re := &RenderError{
+		Phase:    RenderPhaseParse,
+		File:     file,
+		Resource: index,
+		Message:  err.Error(),
+	}
+	if m := yamlLinePattern.FindStringSubmatch(re.Message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		if offset := strings.Index(content, resource); offset >= 0 {
+			line += strings.Count(content[:offset], "\n")
+		}
+		re.Line = line
+	}
+	return re
+}
@@ -0,0 +1,125 @@
+package render
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/helm/pkg/hooks"
+	"k8s.io/helm/pkg/releaseutil"
+)
+
+const (
+	// HookDeleteAnno is the annotation key of hook delete policies.
+	HookDeleteAnno = "helm.sh/hook-delete-policy"
+
+	// HookSucceeded means the hook resource should be deleted after it succeeded.
+	HookSucceeded = "hook-succeeded"
+	// HookFailed means the hook resource should be deleted after it failed.
+	HookFailed = "hook-failed"
+	// HookBeforeCreation means the previous hook resource should be deleted
+	// before a new one is created.
+	HookBeforeCreation = "before-hook-creation"
+)
+
+// Hook is a resource which is executed at specific points of a release lifecycle.
+type Hook struct {
+	// Name is the name of the hook resource.
+	Name string
+	// Kind is the kind of the hook resource.
+	Kind string
+	// Path is the template file which the hook comes from.
+	Path string
+	// Events contains the release events which trigger the hook.
+	Events []string
+	// Weight decides the execution order of hooks for the same event.
+	// Hooks with lower weight are executed earlier.
+	Weight int
+	// DeletePolicies decides when the hook resource should be deleted.
+	DeletePolicies []string
+	// Resource is the rendered resource of the hook.
+	Resource string
+}
+
+// HasEvent checks if the hook should be executed for event.
+func (h *Hook) HasEvent(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDeletePolicy checks if the hook has the delete policy.
+func (h *Hook) HasDeletePolicy(policy string) bool {
+	for _, p := range h.DeletePolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// HooksFor returns hooks which should be executed for event. The hooks are
+// sorted by weight, and then by name.
+func HooksFor(hooks []*Hook, event string) []*Hook {
+	result := make([]*Hook, 0, len(hooks))
+	for _, h := range hooks {
+		if h.HasEvent(event) {
+			result = append(result, h)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Weight == result[j].Weight {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Weight < result[j].Weight
+	})
+	return result
+}
+
+// hookFor parses a resource to a hook. It returns nil if the resource is not a hook.
+func hookFor(file string, resource string) (*Hook, error) {
+	head := &releaseutil.SimpleHead{}
+	err := yaml.Unmarshal([]byte(resource), &head)
+	if err != nil {
+		return nil, err
+	}
+	if head.Metadata == nil || head.Metadata.Annotations == nil {
+		return nil, nil
+	}
+	events, ok := head.Metadata.Annotations[hooks.HookAnno]
+	if !ok {
+		return nil, nil
+	}
+	hook := &Hook{
+		Name:           head.Metadata.Name,
+		Kind:           head.Kind,
+		Path:           file,
+		Events:         splitAnnotation(events),
+		DeletePolicies: splitAnnotation(head.Metadata.Annotations[HookDeleteAnno]),
+		Resource:       resource,
+	}
+	if weight, ok := head.Metadata.Annotations[hooks.HookWeightAnno]; ok {
+		hook.Weight, err = strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil {
+			glog.Warningf("Invalid weight %q of hook %s in %s, use 0 instead", weight, hook.Name, file)
+			hook.Weight = 0
+		}
+	}
+	return hook, nil
+}
+
+// splitAnnotation splits a comma separated annotation value.
+func splitAnnotation(value string) []string {
+	result := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHookFor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		resource string
+		expected *Hook
+	}{
+		{
+			"not a hook",
+			"kind: ConfigMap\nmetadata:\n  name: config\n  annotations:\n    app: web",
+			nil,
+		},
+		{
+			"no annotations",
+			"kind: ConfigMap\nmetadata:\n  name: config",
+			nil,
+		},
+		{
+			"hook",
+			"kind: Job\nmetadata:\n  name: migrate\n  annotations:\n    helm.sh/hook: pre-install, pre-upgrade\n    helm.sh/hook-weight: \" 5 \"\n    helm.sh/hook-delete-policy: hook-succeeded,,before-hook-creation",
+			&Hook{
+				Name:           "migrate",
+				Kind:           "Job",
+				Events:         []string{"pre-install", "pre-upgrade"},
+				Weight:         5,
+				DeletePolicies: []string{HookSucceeded, HookBeforeCreation},
+			},
+		},
+		{
+			"negative weight",
+			"kind: Pod\nmetadata:\n  name: check\n  annotations:\n    helm.sh/hook: post-install\n    helm.sh/hook-weight: \"-1\"",
+			&Hook{
+				Name:           "check",
+				Kind:           "Pod",
+				Events:         []string{"post-install"},
+				Weight:         -1,
+				DeletePolicies: []string{},
+			},
+		},
+		{
+			"invalid weight",
+			"kind: Pod\nmetadata:\n  name: check\n  annotations:\n    helm.sh/hook: post-install\n    helm.sh/hook-weight: high\n    helm.sh/hook-delete-policy: hook-failed",
+			&Hook{
+				Name:           "check",
+				Kind:           "Pod",
+				Events:         []string{"post-install"},
+				DeletePolicies: []string{HookFailed},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		hook, err := hookFor("app/templates/hook.yaml", tc.resource)
+		if err != nil {
+			t.Errorf("%s: can't parse hook: %v", tc.name, err)
+			continue
+		}
+		if tc.expected != nil {
+			tc.expected.Path = "app/templates/hook.yaml"
+			tc.expected.Resource = tc.resource
+		}
+		if !reflect.DeepEqual(hook, tc.expected) {
+			t.Errorf("%s: got hook %+v but expected %+v", tc.name, hook, tc.expected)
+		}
+	}
+}
+
+func TestHooksFor(t *testing.T) {
+	hooks := []*Hook{
+		{Name: "d", Events: []string{"pre-install"}, Weight: 1},
+		{Name: "c", Events: []string{"pre-install", "pre-upgrade"}},
+		{Name: "a", Events: []string{"pre-upgrade"}, Weight: -1},
+		{Name: "b", Events: []string{"pre-install"}},
+		{Name: "e", Events: []string{"post-install"}, Weight: -5},
+	}
+	testCases := []struct {
+		event    string
+		expected []string
+	}{
+		{"pre-install", []string{"b", "c", "d"}},
+		{"pre-upgrade", []string{"a", "c"}},
+		{"post-install", []string{"e"}},
+		{"pre-delete", []string{}},
+	}
+	for _, tc := range testCases {
+		names := []string{}
+		for _, h := range HooksFor(hooks, tc.event) {
+			names = append(names, h.Name)
+		}
+		if !reflect.DeepEqual(names, tc.expected) {
+			t.Errorf("%s: got hooks %v but expected %v", tc.event, names, tc.expected)
+		}
+	}
+}
+
+func TestHookDeletePolicy(t *testing.T) {
+	hook := &Hook{DeletePolicies: []string{HookSucceeded, HookBeforeCreation}}
+	testCases := []struct {
+		policy   string
+		expected bool
+	}{
+		{HookSucceeded, true},
+		{HookBeforeCreation, true},
+		{HookFailed, false},
+	}
+	for _, tc := range testCases {
+		if got := hook.HasDeletePolicy(tc.policy); got != tc.expected {
+			t.Errorf("%s: expected %v but got %v", tc.policy, tc.expected, got)
+		}
+	}
+}
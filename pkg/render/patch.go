@@ -0,0 +1,277 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/caicloud/clientset/kubernetes/scheme"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// PatchType is the type of a post-render patch.
+type PatchType string
+
+const (
+	// StrategicMergePatchType patches resources with strategic merge patch. Kinds
+	// which are not known by rudder are patched with json merge patch.
+	StrategicMergePatchType PatchType = "strategic"
+	// MergePatchType patches resources with json merge patch (RFC 7386).
+	MergePatchType PatchType = "merge"
+	// JSONPatchType patches resources with json patch (RFC 6902).
+	JSONPatchType PatchType = "json6902"
+)
+
+// PatchTarget selects resources for a patch. Empty fields match all resources.
+type PatchTarget struct {
+	// Group is the api group of resources.
+	Group string `json:"group,omitempty"`
+	// Version is the api version of resources.
+	Version string `json:"version,omitempty"`
+	// Kind is the kind of resources.
+	Kind string `json:"kind,omitempty"`
+	// Name is a regular expression for resource names.
+	Name string `json:"name,omitempty"`
+	// LabelSelector selects resources by labels.
+	LabelSelector string `json:"labelSelector,omitempty"`
+}
+
+// Patch is applied to rendered resources before they are handled.
+type Patch struct {
+	// Name is the name of the patch. It's used in logs and errors.
+	Name string `json:"name"`
+	// Namespaces contains namespaces which the patch applies to. If it's empty,
+	// the patch applies to releases of all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Target selects resources to patch.
+	Target PatchTarget `json:"target,omitempty"`
+	// Type is the type of patch. Defaults to strategic.
+	Type PatchType `json:"type,omitempty"`
+	// Patch is the content of patch. It's an object for strategic and merge
+	// patches, and a list of operations for json6902 patches.
+	Patch json.RawMessage `json:"patch"`
+}
+
+// PatchConfig is the format of a patch file. A patch file should like:
+//  patches:
+//  - name: common-labels
+//    patch:
+//      metadata:
+//        labels:
+//          team: platform
+//  - name: registry
+//    namespaces:
+//    - default
+//    target:
+//      kind: Deployment
+//      name: ^web-
+//    type: json6902
+//    patch:
+//    - op: replace
+//      path: /spec/template/spec/containers/0/image
+//      value: registry.local/web:v1
+type PatchConfig struct {
+	// Patches are applied in order.
+	Patches []*Patch `json:"patches"`
+}
+
+// LoadPatches loads patches from a yaml or json file and checks if they are valid.
+func LoadPatches(path string) ([]*Patch, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &PatchConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	for _, p := range config.Patches {
+		if _, err := compilePatch(p); err != nil {
+			return nil, err
+		}
+	}
+	return config.Patches, nil
+}
+
+// PatchesFor returns patches which apply to releases in namespace.
+func PatchesFor(namespace string, patches []*Patch) []*Patch {
+	result := make([]*Patch, 0, len(patches))
+	for _, p := range patches {
+		if len(p.Namespaces) <= 0 {
+			result = append(result, p)
+			continue
+		}
+		for _, ns := range p.Namespaces {
+			if ns == namespace {
+				result = append(result, p)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// patcher is a compiled patch.
+type patcher struct {
+	*Patch
+	name      *regexp.Regexp
+	selector  labels.Selector
+	operation jsonpatch.Patch
+}
+
+// compilePatch checks a patch and compiles its target.
+func compilePatch(p *Patch) (*patcher, error) {
+	pr := &patcher{Patch: p}
+	var err error
+	if p.Target.Name != "" {
+		if pr.name, err = regexp.Compile(p.Target.Name); err != nil {
+			return nil, fmt.Errorf("invalid name of patch %s: %v", p.Name, err)
+		}
+	}
+	if p.Target.LabelSelector != "" {
+		if pr.selector, err = labels.Parse(p.Target.LabelSelector); err != nil {
+			return nil, fmt.Errorf("invalid label selector of patch %s: %v", p.Name, err)
+		}
+	}
+	if len(p.Patch) <= 0 {
+		return nil, fmt.Errorf("empty content of patch %s", p.Name)
+	}
+	switch p.Type {
+	case "", StrategicMergePatchType, MergePatchType:
+	case JSONPatchType:
+		if pr.operation, err = jsonpatch.DecodePatch(p.Patch); err != nil {
+			return nil, fmt.Errorf("invalid content of patch %s: %v", p.Name, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q of patch %s", p.Type, p.Name)
+	}
+	return pr, nil
+}
+
+// patchHead contains fields to select a resource.
+type patchHead struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+}
+
+// match checks if a resource is selected by the patch.
+func (pr *patcher) match(namespace string, gvk schema.GroupVersionKind, head *patchHead) bool {
+	if len(pr.Namespaces) > 0 {
+		found := false
+		for _, ns := range pr.Namespaces {
+			if ns == namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	target := pr.Target
+	if (target.Group != "" && target.Group != gvk.Group) ||
+		(target.Version != "" && target.Version != gvk.Version) ||
+		(target.Kind != "" && target.Kind != gvk.Kind) {
+		return false
+	}
+	if pr.name != nil && !pr.name.MatchString(head.Metadata.Name) {
+		return false
+	}
+	if pr.selector != nil && !pr.selector.Matches(labels.Set(head.Metadata.Labels)) {
+		return false
+	}
+	return true
+}
+
+// apply applies the patch to a json resource.
+func (pr *patcher) apply(gvk schema.GroupVersionKind, data []byte) ([]byte, error) {
+	switch pr.Type {
+	case MergePatchType:
+		return jsonpatch.MergePatch(data, pr.Patch.Patch)
+	case JSONPatchType:
+		return pr.operation.Apply(data)
+	}
+	obj, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		if runtime.IsNotRegisteredError(err) {
+			return jsonpatch.MergePatch(data, pr.Patch.Patch)
+		}
+		return nil, err
+	}
+	return strategicpatch.StrategicMergePatch(data, pr.Patch.Patch, obj)
+}
+
+// patchResource applies patches to a resource. A resource not selected by any
+// patch is returned as it is.
+func patchResource(namespace string, patchers []*patcher, resource string) (string, error) {
+	data, err := yaml.YAMLToJSON([]byte(resource))
+	if err != nil {
+		return "", err
+	}
+	head := &patchHead{}
+	if err := json.Unmarshal(data, head); err != nil {
+		return "", err
+	}
+	gv, err := schema.ParseGroupVersion(head.APIVersion)
+	if err != nil {
+		return "", err
+	}
+	gvk := gv.WithKind(head.Kind)
+	patched := false
+	for _, pr := range patchers {
+		if !pr.match(namespace, gvk, head) {
+			continue
+		}
+		data, err = pr.apply(gvk, data)
+		if err != nil {
+			return "", fmt.Errorf("apply patch %s to %s %s: %v", pr.Name, head.Kind, head.Metadata.Name, err)
+		}
+		patched = true
+	}
+	if !patched {
+		return resource, nil
+	}
+	result, err := yaml.JSONToYAML(data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(result)), nil
+}
+
+// patchResources applies patches to rendered resources and hooks of a release
+// in namespace.
+func patchResources(namespace string, patches []*Patch, resources map[string][]string, hooks []*Hook) error {
+	patchers := make([]*patcher, 0, len(patches))
+	for _, p := range patches {
+		pr, err := compilePatch(p)
+		if err != nil {
+			return err
+		}
+		patchers = append(patchers, pr)
+	}
+	var err error
+	for file, list := range resources {
+		for i := range list {
+			if list[i], err = patchResource(namespace, patchers, list[i]); err != nil {
+				return &RenderError{Phase: RenderPhasePatch, File: file, Resource: i, Message: err.Error()}
+			}
+		}
+	}
+	for _, hook := range hooks {
+		if hook.Resource, err = patchResource(namespace, patchers, hook.Resource); err != nil {
+			return &RenderError{Phase: RenderPhasePatch, File: hook.Path, Resource: -1, Message: err.Error()}
+		}
+	}
+	return nil
+}
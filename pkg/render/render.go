@@ -4,20 +4,22 @@ import (
 	"bytes"
 	"fmt"
 	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/buger/jsonparser"
-	"github.com/ghodss/yaml"
 	"github.com/golang/glog"
 
 	"k8s.io/helm/pkg/chartutil"
-	"k8s.io/helm/pkg/engine"
-	"k8s.io/helm/pkg/hooks"
 	chartapi "k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/releaseutil"
 	"k8s.io/helm/pkg/timeconv"
 )
 
+// notesFileSuffix is the suffix of notes files in charts.
+const notesFileSuffix = "NOTES.txt"
+
 // Options is used to render template.
 type Options struct {
 	// Namespace for resources.
@@ -30,8 +32,21 @@ type Options struct {
 	Template []byte
 	// Config is a json config to render template.
 	Config string
+	// Layers override Config in order. The merged config is used to render
+	// template.
+	Layers []ValuesLayer
 	// Suspend is a flag of release.
 	Suspend *bool
+	// Capabilities provides .Capabilities for templates. If it's nil, templates
+	// get default capabilities of helm.
+	Capabilities CapabilitiesSource
+	// Time is used as .Release.Time in templates. A release should always render
+	// a version with the same time, then the result is reproducible. If it's zero,
+	// current time is used.
+	Time time.Time
+	// Patches are applied to rendered resources in order. Patches which don't
+	// apply to Namespace are ignored.
+	Patches []*Patch
 }
 
 // Render renders template and config to resources.
@@ -42,24 +57,82 @@ type Render interface {
 
 // NewRender creates a template render.
 func NewRender() Render {
+	return NewRenderWithCache(nil)
+}
+
+// NewRenderWithCache creates a template render with a cache. If cache is not nil,
+// the render loads charts and render results from cache preferentially. Carriers
+// from cache are shared, so don't modify them.
+func NewRenderWithCache(cache *Cache) Render {
 	return &render{
-		engine: engine.New(),
+		engine: newEngine(),
+		cache:  cache,
 	}
 }
 
 type render struct {
-	engine *engine.Engine
+	engine *engine
+	cache  *Cache
 }
 
 // Render renders release and return a resources carrier.
 func (r *render) Render(options *Options) (Carrier, error) {
+	kubeVersion := DefaultKubeVersion
+	caps := &chartutil.Capabilities{APIVersions: chartutil.DefaultVersionSet, KubeVersion: &kubeVersion}
+	if options.Capabilities != nil {
+		caps = options.Capabilities.Capabilities()
+	}
+	if r.cache == nil {
+		return r.render(options, caps)
+	}
+
+	digest := digestOf(options.Template)
+	// Results rendered with current time are not reproducible.
+	if options.Time.IsZero() {
+		return r.renderWithDigest(digest, options, caps)
+	}
+	key, err := resultKey(digest, options, caps)
+	if err != nil {
+		return nil, err
+	}
+	if carrier, ok := r.cache.result(key); ok {
+		return carrier, nil
+	}
+	carrier, err := r.renderWithDigest(digest, options, caps)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.setResult(key, carrier)
+	return carrier, nil
+}
+
+// render loads chart from template and renders it.
+func (r *render) render(options *Options, caps *chartutil.Capabilities) (Carrier, error) {
 	chart, err := chartutil.LoadArchive(bytes.NewReader(options.Template))
 	if err != nil {
 		return nil, err
 	}
+	return r.renderChart(chart, options, caps)
+}
+
+// renderWithDigest loads chart from cache and renders it.
+func (r *render) renderWithDigest(digest string, options *Options, caps *chartutil.Capabilities) (Carrier, error) {
+	chart, err := r.cache.chart(digest, options.Template)
+	if err != nil {
+		return nil, err
+	}
+	return r.renderChart(chart, options, caps)
+}
+
+// renderChart renders chart to a carrier. The chart may be modified.
+func (r *render) renderChart(chart *chartapi.Chart, options *Options, caps *chartutil.Capabilities) (Carrier, error) {
+	releaseTime := timeconv.Now()
+	if !options.Time.IsZero() {
+		releaseTime = timeconv.Timestamp(options.Time)
+	}
 	releaseOpts := chartutil.ReleaseOptions{
 		Name:      options.Release,
-		Time:      timeconv.Now(),
+		Time:      releaseTime,
 		Namespace: options.Namespace,
 		Revision:  int(options.Version),
 		IsInstall: true,
@@ -71,35 +144,110 @@ func (r *render) Render(options *Options) (Carrier, error) {
 		return nil, err
 	}
 
-	values, err := chartutil.ToRenderValues(chart, &chartapi.Config{Raw: config}, releaseOpts)
+	// Paths of charts are collected before subcharts are disabled.
+	charts := make(map[string]bool)
+	chartPaths(chart, "", charts)
+	if err = r.processRequirements(chart, config); err != nil {
+		glog.Errorf("render release: %s 's requirements error: %v", options.Release, err)
+		return nil, err
+	}
+
+	values, err := chartutil.ToRenderValuesCaps(chart, &chartapi.Config{Raw: config}, releaseOpts, caps)
 	if err != nil {
 		return nil, err
 	}
 
-	resources, err := r.renderResources(chart, values)
+	if vals, ok := values["Values"].(chartutil.Values); ok {
+		if err = ValidateValues(chart, vals); err != nil {
+			glog.Errorf("render release: %s 's config is invalid: %v", options.Release, err)
+			return nil, err
+		}
+	}
+
+	resources, hooks, notes, err := r.renderResources(chart, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.Patches) > 0 {
+		if err = patchResources(options.Namespace, options.Patches, resources, hooks); err != nil {
+			glog.Errorf("render release: %s 's resources can't be patched: %v", options.Release, err)
+			return nil, err
+		}
+	}
+	carrier, err := treeCarrierFor(resources)
 	if err != nil {
 		return nil, err
 	}
-	return treeCarrierFor(resources)
+	carrier.hooks = hooks
+	carrier.notes = notes
+	chartPaths(chart, "", charts)
+	return carrierWithDependencies(carrier, charts)
+}
+
+// chartPaths adds paths of chart and all its subcharts to paths. Subcharts
+// declared in requirements.yaml are added by their names and aliases.
+func chartPaths(chart *chartapi.Chart, parent string, paths map[string]bool) {
+	current := path.Join(parent, chart.Metadata.Name)
+	paths[current] = true
+	if reqs, err := chartutil.LoadRequirements(chart); err == nil {
+		for _, dep := range reqs.Dependencies {
+			paths[path.Join(current, dep.Name)] = true
+			if dep.Alias != "" {
+				paths[path.Join(current, dep.Alias)] = true
+			}
+		}
+	}
+	for _, child := range chart.Dependencies {
+		chartPaths(child, current, paths)
+	}
 }
 
-// renderResources renders chart to a list of resources
-func (r *render) renderResources(chart *chartapi.Chart, values chartutil.Values) (map[string][]string, error) {
+// processRequirements processes requirements.yaml of chart like helm does:
+// * Subcharts disabled by conditions or tags are removed from the chart.
+// * Values of enabled subcharts are imported to parents by import-values.
+// A chart without requirements.yaml is not changed.
+func (r *render) processRequirements(chart *chartapi.Chart, config string) error {
+	err := chartutil.ProcessRequirementsEnabled(chart, &chartapi.Config{Raw: config})
+	if err != nil {
+		return err
+	}
+	return chartutil.ProcessRequirementsImportValues(chart)
+}
+
+// renderResources renders chart to a list of resources, a list of hooks and
+// the notes of the top-level chart.
+func (r *render) renderResources(chart *chartapi.Chart, values chartutil.Values) (map[string][]string, []*Hook, string, error) {
 	files, err := r.engine.Render(chart, values)
 	if err != nil {
-		return nil, err
+		return nil, nil, "", templateError(err)
 	}
 	// result is a file-resources map
 	result := make(map[string][]string)
+	hooks := make([]*Hook, 0)
+	notes := ""
+	notesFile := path.Join(chart.Metadata.Name, "templates", notesFileSuffix)
 
 	// Remove unused files:
 	// * Files which name has suffix "NOTES.txt"
 	// * Files which name starts with "_"
-	// * Hooks
-	// These files are defined by helm, we don't need them.
-	for k, v := range files {
+	// These files are defined by helm, we don't need them. But notes of the
+	// top-level chart are kept for users.
+	// Hooks are picked out and kept apart from normal resources.
+	// Files and resources in files are handled in order. Then errors and
+	// hooks are stable for the same chart.
+	names := make([]string, 0, len(files))
+	for k := range files {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v := files[k]
 		base := path.Base(k)
-		if strings.HasPrefix(base, "_") || strings.HasSuffix(base, "NOTES.txt") {
+		if k == notesFile {
+			notes = strings.TrimSpace(v)
+		}
+		if strings.HasPrefix(base, "_") || strings.HasSuffix(base, notesFileSuffix) {
 			continue
 		}
 
@@ -109,12 +257,14 @@ func (r *render) renderResources(chart *chartapi.Chart, values chartutil.Values)
 			continue
 		}
 		validRes := make([]string, 0, len(resources))
-		for _, res := range resources {
-			ok, err := r.isHook(res)
+		for _, name := range manifestNames(resources) {
+			res := resources[name]
+			hook, err := hookFor(k, res)
 			if err != nil {
-				return nil, err
+				return nil, nil, "", parseError(k, v, manifestIndex(name), res, err)
 			}
-			if ok {
+			if hook != nil {
+				hooks = append(hooks, hook)
 				continue
 			}
 			// Add resources to result map
@@ -122,30 +272,19 @@ func (r *render) renderResources(chart *chartapi.Chart, values chartutil.Values)
 		}
 		result[k] = validRes
 	}
-	return result, nil
+	return result, hooks, notes, nil
 }
 
-// isHook checks whether the resource is a helm hook
-func (r *render) isHook(resource string) (bool, error) {
-	head := &releaseutil.SimpleHead{}
-	err := yaml.Unmarshal([]byte(resource), &head)
+func (r *render) renderConfig(options *Options) (string, error) {
+	config, err := MergeConfig(options.Config, options.Layers)
 	if err != nil {
-		return false, err
-	}
-	if head.Metadata == nil || head.Metadata.Annotations == nil {
-		return false, nil
+		return "", err
 	}
-	_, ok := head.Metadata.Annotations[hooks.HookAnno]
-	return ok, nil
-}
-
-func (r *render) renderConfig(options *Options) (string, error) {
 	if options.Suspend == nil || (options.Suspend != nil && !*options.Suspend) {
-		return options.Config, nil
+		return config, nil
 	}
 
-	var err error
-	confBytes := []byte(options.Config)
+	confBytes := []byte(config)
 	count := 0
 	cb := func(value []byte, dataType jsonparser.ValueType, offset int, _ error) {
 		defer func() { count++ }()
@@ -174,7 +313,7 @@ func (r *render) renderConfig(options *Options) (string, error) {
 	_, err = jsonparser.ArrayEach(confBytes, cb, "_config", "controllers")
 	if err != nil {
 		glog.Errorf("render release: %s suspend flag error: %v", options.Release, err)
-		glog.Errorf("release: %s 's config: %s", options.Release, options.Config)
+		glog.Errorf("release: %s 's config: %s", options.Release, config)
 		return "", err
 	}
 	return string(confBytes), nil
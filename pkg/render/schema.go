@@ -0,0 +1,206 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/xeipuuv/gojsonreference"
+	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/helm/pkg/chartutil"
+	chartapi "k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// SchemaFile is the file name of values schema in a chart.
+const SchemaFile = "values.schema.json"
+
+// Schema is a JSON Schema for values. Schemas are draft-07 unless they declare
+// another draft in $schema. References to other documents are not allowed, so
+// a schema never makes the controller read files or send requests.
+type Schema struct {
+	schema *gojsonschema.Schema
+}
+
+// metaSchemas contains urls of meta schemas which are embedded in gojsonschema.
+var metaSchemas = map[string]bool{
+	"http://json-schema.org/draft-04/schema": true,
+	"http://json-schema.org/draft-06/schema": true,
+	"http://json-schema.org/draft-07/schema": true,
+}
+
+// defaultMetaSchema is the meta schema of schemas without $schema.
+const defaultMetaSchema = "http://json-schema.org/draft-07/schema#"
+
+// LoadSchema loads a schema from json or yaml data. The schema is checked
+// against its meta schema.
+func LoadSchema(data []byte) (*Schema, error) {
+	document, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid values schema: %v", err)
+	}
+	if err := validateSchema(document); err != nil {
+		return nil, fmt.Errorf("invalid values schema: %v", err)
+	}
+	loader := gojsonschema.NewSchemaLoader()
+	loader.Draft = gojsonschema.Draft7
+	schema, err := loader.Compile(localLoader{gojsonschema.NewBytesLoader(document)})
+	if err != nil {
+		return nil, fmt.Errorf("invalid values schema: %v", err)
+	}
+	return &Schema{schema}, nil
+}
+
+// validateSchema validates a schema document against its meta schema.
+func validateSchema(document []byte) error {
+	header := map[string]interface{}{}
+	url := defaultMetaSchema
+	if err := json.Unmarshal(document, &header); err == nil {
+		if value, ok := header["$schema"].(string); ok && value != "" {
+			url = value
+		}
+	}
+	meta, err := gojsonschema.NewSchemaLoader().Compile(localLoader{gojsonschema.NewReferenceLoader(url)})
+	if err != nil {
+		return fmt.Errorf("unsupported $schema %s: %v", url, err)
+	}
+	result, err := meta.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return err
+	}
+	if !result.Valid() {
+		msgs := make([]string, len(result.Errors()))
+		for i, e := range result.Errors() {
+			msgs[i] = e.String()
+		}
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// localLoader loads a schema which can only refer to itself and meta schemas.
+type localLoader struct {
+	gojsonschema.JSONLoader
+}
+
+// LoaderFactory returns a factory which refuses to load external documents.
+func (l localLoader) LoaderFactory() gojsonschema.JSONLoaderFactory {
+	return externalLoaderFactory{}
+}
+
+// externalLoaderFactory creates loaders for external references.
+type externalLoaderFactory struct{}
+
+// New creates a loader for source. Only embedded meta schemas can be loaded.
+func (externalLoaderFactory) New(source string) gojsonschema.JSONLoader {
+	if metaSchemas[strings.TrimSuffix(source, "#")] {
+		return localLoader{gojsonschema.NewReferenceLoader(source)}
+	}
+	return externalLoader(source)
+}
+
+// externalLoader is an external reference which is not allowed.
+type externalLoader string
+
+func (l externalLoader) JsonSource() interface{} {
+	return string(l)
+}
+
+func (l externalLoader) LoadJSON() (interface{}, error) {
+	return nil, fmt.Errorf("external reference %s is not allowed", string(l))
+}
+
+func (l externalLoader) JsonReference() (gojsonreference.JsonReference, error) {
+	return gojsonreference.NewJsonReference(string(l))
+}
+
+func (l externalLoader) LoaderFactory() gojsonschema.JSONLoaderFactory {
+	return externalLoaderFactory{}
+}
+
+// SchemaViolation describes a value which doesn't meet the schema.
+type SchemaViolation struct {
+	// Path is the path of the value. For example: image.tag, ports.0.name.
+	Path string
+	// Message describes why the value is invalid.
+	Message string
+}
+
+// SchemaError is returned when values don't meet the schema.
+type SchemaError struct {
+	// Chart is the chart which the schema belongs to.
+	Chart string
+	// Violations contains all invalid values.
+	Violations []SchemaViolation
+}
+
+// Error returns all violations in one line.
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = fmt.Sprintf("%s: %s", v.Path, v.Message)
+	}
+	return fmt.Sprintf("values of chart %s don't meet the schema: %s", e.Chart, strings.Join(msgs, "; "))
+}
+
+// Validate validates values against the schema. It returns all violations
+// sorted by path. Values are converted to json first, so nested
+// chartutil.Values are objects.
+func (s *Schema) Validate(values interface{}) ([]SchemaViolation, error) {
+	document, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return nil, err
+	}
+	violations := make([]SchemaViolation, 0, len(result.Errors()))
+	for _, e := range result.Errors() {
+		violations = append(violations, SchemaViolation{e.Field(), e.Description()})
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path < violations[j].Path
+	})
+	return violations, nil
+}
+
+// ValidateValues validates values of a chart and its subcharts against their
+// schemas. Charts without schema are not validated.
+func ValidateValues(chart *chartapi.Chart, values chartutil.Values) error {
+	return validateChartValues(chart, chart.Metadata.Name, map[string]interface{}(values))
+}
+
+func validateChartValues(chart *chartapi.Chart, name string, values map[string]interface{}) error {
+	for _, f := range chart.Files {
+		if f.TypeUrl != SchemaFile {
+			continue
+		}
+		schema, err := LoadSchema(f.Value)
+		if err != nil {
+			return fmt.Errorf("chart %s: %v", name, err)
+		}
+		violations, err := schema.Validate(values)
+		if err != nil {
+			return fmt.Errorf("chart %s: %v", name, err)
+		}
+		if len(violations) > 0 {
+			return &SchemaError{name, violations}
+		}
+		break
+	}
+	for _, dep := range chart.Dependencies {
+		subValues := map[string]interface{}{}
+		switch v := values[dep.Metadata.Name].(type) {
+		case map[string]interface{}:
+			subValues = v
+		case chartutil.Values:
+			subValues = v
+		}
+		if err := validateChartValues(dep, name+"/"+dep.Metadata.Name, subValues); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/helm/pkg/chartutil"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		schema string
+		values map[string]interface{}
+		paths  []string
+	}{
+		{
+			"valid values",
+			`{"type": "object", "properties": {"replicas": {"type": "integer", "minimum": 1}}}`,
+			map[string]interface{}{"replicas": 3},
+			[]string{},
+		},
+		{
+			"wrong type and missing required value",
+			`{"type": "object", "required": ["image"], "properties": {"replicas": {"type": "integer"}}}`,
+			map[string]interface{}{"replicas": "3"},
+			[]string{"(root)", "replicas"},
+		},
+		{
+			"nested chartutil values are objects",
+			`{"properties": {"image": {"type": "object", "required": ["tag"]}}}`,
+			map[string]interface{}{"image": chartutil.Values{"repository": "nginx"}},
+			[]string{"image"},
+		},
+		{
+			"references to definitions",
+			`{
+			  "definitions": {"port": {"type": "integer", "maximum": 65535}},
+			  "properties": {"ports": {"type": "array", "items": {"$ref": "#/definitions/port"}}}
+			}`,
+			map[string]interface{}{"ports": []interface{}{80, 70000}},
+			[]string{"ports.1"},
+		},
+		{
+			"pattern properties",
+			`{"patternProperties": {"^env_": {"type": "string"}}}`,
+			map[string]interface{}{"env_a": "a", "env_b": 1, "other": 1},
+			[]string{"env_b"},
+		},
+		{
+			"if then else",
+			`{
+			  "if": {"properties": {"persistence": {"const": true}}},
+			  "then": {"required": ["size"]},
+			  "else": {"not": {"required": ["size"]}}
+			}`,
+			map[string]interface{}{"persistence": true},
+			[]string{"(root)", "(root)"},
+		},
+		{
+			"dependencies",
+			`{"dependencies": {"tls": ["certificate"]}}`,
+			map[string]interface{}{"tls": true},
+			[]string{"(root)"},
+		},
+		{
+			"format",
+			`{"properties": {"host": {"type": "string", "format": "ipv4"}}}`,
+			map[string]interface{}{"host": "not-an-ip"},
+			[]string{"host"},
+		},
+	}
+	for _, tc := range testCases {
+		schema, err := LoadSchema([]byte(tc.schema))
+		if err != nil {
+			t.Errorf("%s: can't load schema: %v", tc.name, err)
+			continue
+		}
+		violations, err := schema.Validate(tc.values)
+		if err != nil {
+			t.Errorf("%s: can't validate values: %v", tc.name, err)
+			continue
+		}
+		paths := make([]string, len(violations))
+		for i, v := range violations {
+			paths[i] = v.Path
+		}
+		if !reflect.DeepEqual(paths, tc.paths) {
+			t.Errorf("%s: got violations %v but expected paths %v", tc.name, violations, tc.paths)
+		}
+	}
+}
+
+func TestLoadInvalidSchema(t *testing.T) {
+	testCases := []struct {
+		name   string
+		schema string
+	}{
+		{"malformed document", `{"type": `},
+		{"invalid keyword value", `{"type": "object", "minProperties": "one"}`},
+		{"unknown type", `{"type": "integer32"}`},
+		{"remote reference", `{"properties": {"a": {"$ref": "http://127.0.0.1:1/schema.json"}}}`},
+		{"file reference", `{"properties": {"a": {"$ref": "file:///etc/passwd"}}}`},
+		{"remote meta schema", `{"$schema": "http://127.0.0.1:1/schema.json", "type": "object"}`},
+	}
+	for _, tc := range testCases {
+		if _, err := LoadSchema([]byte(tc.schema)); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
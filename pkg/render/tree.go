@@ -3,6 +3,7 @@ package render
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -17,26 +18,30 @@ func CarrierForManifest(manifest string) (Carrier, error) {
 	return CarrierForResources(resources)
 }
 
-// CarrierForResources returns a carrier for resources.
+// CarrierForResources returns a carrier for resources. Errors are *RenderError
+// and the index of resource is the index in resources.
 func CarrierForResources(resources []string) (Carrier, error) {
 	var root *node
-	var res resource
-	for _, r := range resources {
+	for i, r := range resources {
+		var res resource
 		err := yaml.Unmarshal([]byte(r), &res)
 		if err != nil {
-			return nil, err
+			return nil, parseError("", "", i, r, err)
+		}
+		carrierError := func(msg string) error {
+			return &RenderError{Phase: RenderPhaseCarrier, Resource: i, Message: msg}
 		}
 		if res.Metadata.Annotations == nil {
-			return nil, fmt.Errorf("unknown resource object")
+			return nil, carrierError(fmt.Sprintf("unknown resource object %s %s: no annotations", res.Kind, res.Metadata.Name))
 		}
 		path, ok := res.Metadata.Annotations[string(releaseutil.DefaultPathKey)]
 		if !ok || path == "" {
-			return nil, fmt.Errorf("unknown resource for carrier")
+			return nil, carrierError(fmt.Sprintf("unknown resource %s %s for carrier: no annotation %s", res.Kind, res.Metadata.Name, releaseutil.DefaultPathKey))
 		}
 		// Split path by /
 		paths := strings.Split(path, "/")
 		if len(paths) <= 0 {
-			return nil, fmt.Errorf("unknown resource path for carrier")
+			return nil, carrierError(fmt.Sprintf("unknown resource path %s for carrier", path))
 		}
 		if root == nil {
 			// Paths length must greater than 0
@@ -44,28 +49,38 @@ func CarrierForResources(resources []string) (Carrier, error) {
 		}
 		err = root.add(paths, []string{r})
 		if err != nil {
-			return nil, err
+			return nil, carrierError(err.Error())
 		}
 	}
-	return &treeCarrier{
+	// Dependencies have been checked when the manifest was rendered.
+	return carrierWithDependencies(&treeCarrier{
 		root: root,
-	}, nil
+	}, nil)
 }
 
 // Resource defines common fields of kubernetes resources
 type resource struct {
+	Kind     string `json:"kind"`
 	Metadata struct {
+		Name        string            `json:"name"`
 		Annotations map[string]string `json:"annotations"`
 	} `json:"metadata"`
 }
 
-// treeCarrierFor creates carrier by resources.
+// treeCarrierFor creates carrier by resources. Files are added in lexical
+// order, so resources of a node are ordered by file and then by index in file.
 func treeCarrierFor(resources map[string][]string) (*treeCarrier, error) {
+	files := make([]string, 0, len(resources))
+	for file := range resources {
+		files = append(files, file)
+	}
+	sort.Strings(files)
 	var root *node
-	for file, resources := range resources {
+	for _, file := range files {
+		resources := resources[file]
 		paths, err := logicPathForFile(file)
 		if err != nil {
-			return nil, err
+			return nil, &RenderError{Phase: RenderPhaseCarrier, File: file, Resource: -1, Message: err.Error()}
 		}
 		if root == nil {
 			// paths length must greater than 0
@@ -73,7 +88,7 @@ func treeCarrierFor(resources map[string][]string) (*treeCarrier, error) {
 		}
 		err = root.add(paths, resources)
 		if err != nil {
-			return nil, err
+			return nil, &RenderError{Phase: RenderPhaseCarrier, File: file, Resource: -1, Message: err.Error()}
 		}
 	}
 	return &treeCarrier{
@@ -172,20 +187,32 @@ func (n *node) find(paths []string) (*node, error) {
 	return parent, nil
 }
 
-// walkthrough walkthroughs all nodes. The result of handler decides
+// sortedChildren returns children of n sorted by name.
+func (n *node) sortedChildren() []*node {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	children := make([]*node, len(names))
+	for i, name := range names {
+		children[i] = n.children[name]
+	}
+	return children
+}
+
+// walkthrough walkthroughs all nodes in depth-first order. A node is visited
+// before its children, and children are visited in order of their names. So
+// nodes are visited in order of their paths. The result of handler decides
 // whether it should continue.
 func (n *node) walkthrough(handler func(*node) bool) bool {
-	nodes := []*node{n}
-	for len(nodes) > 0 {
-		n := nodes[0]
-		ok := handler(n)
-		if !ok {
+	if !handler(n) {
+		return false
+	}
+	for _, child := range n.sortedChildren() {
+		if !child.walkthrough(handler) {
 			return false
 		}
-		nodes = nodes[1:]
-		for _, n := range n.children {
-			nodes = append(nodes, n)
-		}
 	}
 	return true
 }
@@ -208,7 +235,7 @@ func (n *node) handleChildren(ctx context.Context, handler CarrierHandler, exec
 	wg.Add(len(n.children))
 	errSync := &sync.Mutex{}
 	errList := make([]error, 0)
-	for _, child := range n.children {
+	for _, child := range n.sortedChildren() {
 		go func(n *node) {
 			if err := exec(ctx, n, handler, wg); err != nil {
 				errSync.Lock()
@@ -254,7 +281,9 @@ func (n *node) execReversely(ctx context.Context, handler CarrierHandler, wg *sy
 
 // treeCarrier implements a basic tree-like graph for chart now.
 type treeCarrier struct {
-	root *node
+	root  *node
+	hooks []*Hook
+	notes string
 }
 
 // Run executes all resources via handler. The ctx should be a cancelable
@@ -275,7 +304,8 @@ func (tc *treeCarrier) Run(ctx context.Context, order CarrierOrder, handler Carr
 	}
 }
 
-// Resources returns all resources.
+// Resources returns all resources. Resources are ordered by node path, then by
+// file and then by index in file.
 func (tc *treeCarrier) Resources() []string {
 	if tc.root == nil {
 		return []string{}
@@ -303,3 +333,13 @@ func (tc *treeCarrier) ResourcesOf(target string) ([]string, error) {
 	}
 	return node.resources, nil
 }
+
+// Hooks returns all hooks. Hooks are not included in Resources().
+func (tc *treeCarrier) Hooks() []*Hook {
+	return tc.hooks
+}
+
+// Notes returns rendered NOTES.txt of the top-level chart.
+func (tc *treeCarrier) Notes() string {
+	return tc.notes
+}
@@ -0,0 +1,191 @@
+package render
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"k8s.io/helm/pkg/chartutil"
+	chartapi "k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/releaseutil"
+)
+
+// entry is a generated resource and its expected position.
+type entry struct {
+	paths    []string
+	file     string
+	index    int
+	resource string
+}
+
+// randomResources generates a file-resources map for a random chart tree.
+func randomResources(r *rand.Rand) (map[string][]string, []entry) {
+	charts := [][]string{{"app"}}
+	for i := r.Intn(8); i > 0; i-- {
+		parent := charts[r.Intn(len(charts))]
+		child := append(append([]string{}, parent...), fmt.Sprintf("sub%d", r.Intn(5)))
+		charts = append(charts, child)
+	}
+	files := make(map[string][]string)
+	entries := []entry{}
+	for _, paths := range charts {
+		dir := strings.Join(paths, "/charts/")
+		for i := r.Intn(4); i > 0; i-- {
+			file := fmt.Sprintf("%s/templates/t%d.yaml", dir, r.Intn(6))
+			if _, ok := files[file]; ok {
+				continue
+			}
+			count := 1 + r.Intn(4)
+			for j := 0; j < count; j++ {
+				resource := fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: %s-%d\n  annotations:\n    %s: %s",
+					strings.Replace(file, "/", ".", -1), j, releaseutil.DefaultPathKey, strings.Join(paths, "/"))
+				files[file] = append(files[file], resource)
+				entries = append(entries, entry{paths, file, j, resource})
+			}
+		}
+	}
+	return files, entries
+}
+
+// chartFor builds a chart archive in dir whose templates are rendered to files.
+// Templates are added in map order, so the order of templates and subcharts is
+// random.
+func chartFor(dir string, files map[string][]string) ([]byte, error) {
+	charts := make(map[string]*chartapi.Chart)
+	var chartOf func(dir string) *chartapi.Chart
+	chartOf = func(dir string) *chartapi.Chart {
+		if c, ok := charts[dir]; ok {
+			return c
+		}
+		c := &chartapi.Chart{Metadata: &chartapi.Metadata{Name: path.Base(dir), Version: "0.1.0"}}
+		charts[dir] = c
+		if i := strings.LastIndex(dir, "/charts/"); i > 0 {
+			parent := chartOf(dir[:i])
+			parent.Dependencies = append(parent.Dependencies, c)
+		}
+		return c
+	}
+	root := chartOf("app")
+	for file, resources := range files {
+		i := strings.LastIndex(file, "/templates/")
+		c := chartOf(file[:i])
+		c.Templates = append(c.Templates, &chartapi.Template{
+			Name: file[i+1:],
+			Data: []byte(strings.Join(resources, "\n---\n")),
+		})
+	}
+	name, err := chartutil.Save(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(name)
+}
+
+// lessPaths compares logic paths. A parent is less than its children.
+func lessPaths(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func TestResourcesOrderIsStable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudder-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	property := func(seed int64) bool {
+		files, entries := randomResources(rand.New(rand.NewSource(seed)))
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i], entries[j]
+			if !reflect.DeepEqual(a.paths, b.paths) {
+				return lessPaths(a.paths, b.paths)
+			}
+			if a.file != b.file {
+				return a.file < b.file
+			}
+			return a.index < b.index
+		})
+		expected := make([]string, len(entries))
+		for i, e := range entries {
+			expected[i] = e.resource
+		}
+
+		// Maps are iterated in random order. Build and render charts several times.
+		for i := 0; i < 5; i++ {
+			template, err := chartFor(dir, files)
+			if err != nil {
+				t.Errorf("seed %d: can't create chart: %v", seed, err)
+				return false
+			}
+			carrier, err := NewRender().Render(&Options{
+				Namespace: "default",
+				Release:   "app",
+				Template:  template,
+				Config:    "{}",
+			})
+			if err != nil {
+				t.Errorf("seed %d: can't render chart: %v", seed, err)
+				return false
+			}
+			if got := carrier.Resources(); !reflect.DeepEqual(got, expected) {
+				t.Errorf("seed %d: unexpected order:\n%v\nexpected:\n%v", seed, got, expected)
+				return false
+			}
+		}
+		if len(expected) <= 0 {
+			return true
+		}
+
+		// Carriers from manifests keep the order.
+		manifest := MergeResources(expected)
+		for i := 0; i < 5; i++ {
+			carrier, err := CarrierForManifest(manifest)
+			if err != nil {
+				t.Errorf("seed %d: can't create carrier from manifest: %v", seed, err)
+				return false
+			}
+			if got := MergeResources(carrier.Resources()); got != manifest {
+				t.Errorf("seed %d: manifest is changed:\n%s\nexpected:\n%s", seed, got, manifest)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestManifestNames(t *testing.T) {
+	property := func(count uint8) bool {
+		docs := make([]string, int(count)%20+1)
+		for i := range docs {
+			docs[i] = fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: cm-%d", i)
+		}
+		resources := releaseutil.SplitManifests(strings.Join(docs, "\n---\n"))
+		names := manifestNames(resources)
+		if len(names) != len(docs) {
+			return false
+		}
+		for i, name := range names {
+			if resources[name] != docs[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
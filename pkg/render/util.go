@@ -1,6 +1,9 @@
 package render
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
 const delimiter = "\n---\n"
 
@@ -21,3 +24,16 @@ func SplitManifest(manifest string) []string {
 	}
 	return result[:length:length]
 }
+
+// manifestNames returns names of resources from releaseutil.SplitManifests in
+// order of their indexes in the manifest.
+func manifestNames(resources map[string]string) []string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return manifestIndex(names[i]) < manifestIndex(names[j])
+	})
+	return names
+}
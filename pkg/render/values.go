@@ -0,0 +1,165 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// ValuesLayer is a resolved document of values which overrides the config of a
+// release.
+type ValuesLayer struct {
+	// Name is the name of the layer. It's used in errors.
+	Name string
+	// Values is a json or yaml document.
+	Values string
+	// Secret marks a layer which comes from a Secret. SplitConfig keeps its
+	// values apart from others.
+	Secret bool
+}
+
+// MergeConfig merges layers into config in order. Later layers override earlier
+// ones like helm does for multiple values files:
+// * Tables are merged recursively.
+// * Other values are replaced.
+// * A null value deletes the key.
+// The result is a json config.
+func MergeConfig(config string, layers []ValuesLayer) (string, error) {
+	if len(layers) <= 0 {
+		return config, nil
+	}
+	result, err := readValues(config)
+	if err != nil {
+		return "", fmt.Errorf("invalid config: %v", err)
+	}
+	for _, layer := range layers {
+		values, err := readValues(layer.Values)
+		if err != nil {
+			return "", fmt.Errorf("invalid values layer %s: %v", layer.Name, err)
+		}
+		result = coalesceLayer(result, values)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// readValues reads a json or yaml document to a table.
+func readValues(data string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if strings.TrimSpace(data) == "" {
+		return values, nil
+	}
+	if err := yaml.Unmarshal([]byte(data), &values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return values, nil
+}
+
+// coalesceLayer merges src into dst. src is considered authoritative.
+func coalesceLayer(dst, src map[string]interface{}) map[string]interface{} {
+	for key, val := range src {
+		if val == nil {
+			delete(dst, key)
+			continue
+		}
+		srcTable, ok := val.(map[string]interface{})
+		if !ok {
+			dst[key] = val
+			continue
+		}
+		dstTable, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstTable = map[string]interface{}{}
+		}
+		dst[key] = coalesceLayer(dstTable, srcTable)
+	}
+	return dst
+}
+
+// secretValue wraps a value which comes from a secret layer.
+type secretValue struct {
+	value interface{}
+}
+
+// SplitConfig merges layers into config like MergeConfig, but splits the result
+// into two json documents. The first one contains values which don't come from
+// secret layers, and the second one contains the others. Merging the second one
+// into the first one with MergeConfig gives the effective config. The second one
+// is empty if no value comes from secret layers.
+func SplitConfig(config string, layers []ValuesLayer) (string, string, error) {
+	if len(layers) <= 0 {
+		return config, "", nil
+	}
+	result, err := readValues(config)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid config: %v", err)
+	}
+	for _, layer := range layers {
+		values, err := readValues(layer.Values)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid values layer %s: %v", layer.Name, err)
+		}
+		if layer.Secret {
+			values = wrapSecrets(values)
+		}
+		result = coalesceLayer(result, values)
+	}
+	public, secret := splitSecrets(result)
+	publicData, err := json.Marshal(public)
+	if err != nil {
+		return "", "", err
+	}
+	if len(secret) <= 0 {
+		return string(publicData), "", nil
+	}
+	secretData, err := json.Marshal(secret)
+	if err != nil {
+		return "", "", err
+	}
+	return string(publicData), string(secretData), nil
+}
+
+// wrapSecrets wraps all values except non-empty tables in values. Wrapped
+// values replace tables when they are merged, as other values do.
+func wrapSecrets(values map[string]interface{}) map[string]interface{} {
+	for key, val := range values {
+		if table, ok := val.(map[string]interface{}); ok && len(table) > 0 {
+			values[key] = wrapSecrets(table)
+		} else if val != nil {
+			values[key] = secretValue{val}
+		}
+	}
+	return values
+}
+
+// splitSecrets splits wrapped values out of values. Tables which become empty
+// are dropped, unless they are empty in values.
+func splitSecrets(values map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	public := map[string]interface{}{}
+	secret := map[string]interface{}{}
+	for key, val := range values {
+		switch v := val.(type) {
+		case secretValue:
+			secret[key] = v.value
+		case map[string]interface{}:
+			p, s := splitSecrets(v)
+			if len(p) > 0 || len(v) <= 0 {
+				public[key] = p
+			}
+			if len(s) > 0 {
+				secret[key] = s
+			}
+		default:
+			public[key] = val
+		}
+	}
+	return public, secret
+}
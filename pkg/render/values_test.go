@@ -0,0 +1,95 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestSplitConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+		layers []ValuesLayer
+		public string
+		secret string
+	}{
+		{
+			"no layers",
+			`{"replicas": 1}`,
+			nil,
+			`{"replicas": 1}`,
+			"",
+		},
+		{
+			"no secret layers",
+			`{"replicas": 1}`,
+			[]ValuesLayer{{Name: "team", Values: "replicas: 3\nimage: {tag: v1}"}},
+			`{"image":{"tag":"v1"},"replicas":3}`,
+			"",
+		},
+		{
+			"secret values in tables",
+			`{"image": {"repository": "nginx"}, "db": {"host": "db"}}`,
+			[]ValuesLayer{{Name: "tag", Values: "db: {password: pass}\nimage: {tag: v1}", Secret: true}},
+			`{"db":{"host":"db"},"image":{"repository":"nginx"}}`,
+			`{"db":{"password":"pass"},"image":{"tag":"v1"}}`,
+		},
+		{
+			"later layers override secret values",
+			`{}`,
+			[]ValuesLayer{
+				{Name: "secret", Values: "image: {tag: v1}\ntoken: abc", Secret: true},
+				{Name: "team", Values: "image: {tag: v2}"},
+			},
+			`{"image":{"tag":"v2"}}`,
+			`{"token":"abc"}`,
+		},
+		{
+			"secret values replace tables",
+			`{"auth": {"user": "admin"}}`,
+			[]ValuesLayer{{Name: "secret", Values: "auth: token", Secret: true}},
+			`{}`,
+			`{"auth":"token"}`,
+		},
+		{
+			"secret layers delete values",
+			`{"auth": {"user": "admin"}, "replicas": 1}`,
+			[]ValuesLayer{{Name: "secret", Values: "auth: null", Secret: true}},
+			`{"replicas":1}`,
+			"",
+		},
+		{
+			"empty tables",
+			`{"annotations": {}}`,
+			[]ValuesLayer{{Name: "secret", Values: "labels: {}", Secret: true}},
+			`{"annotations":{}}`,
+			`{"labels":{}}`,
+		},
+	}
+	for _, tc := range testCases {
+		public, secret, err := SplitConfig(tc.config, tc.layers)
+		if err != nil {
+			t.Errorf("%s: can't split config: %v", tc.name, err)
+			continue
+		}
+		if public != tc.public || secret != tc.secret {
+			t.Errorf("%s: got %s and %s but expected %s and %s", tc.name, public, secret, tc.public, tc.secret)
+			continue
+		}
+		expected, err := MergeConfig(tc.config, tc.layers)
+		if err != nil {
+			t.Errorf("%s: can't merge config: %v", tc.name, err)
+			continue
+		}
+		restored := public
+		if secret != "" {
+			restored, err = MergeConfig(public, []ValuesLayer{{Name: "secret", Values: secret}})
+			if err != nil {
+				t.Errorf("%s: can't restore config: %v", tc.name, err)
+				continue
+			}
+		}
+		if restored != expected {
+			t.Errorf("%s: restored config %s but expected %s", tc.name, restored, expected)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package render
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+)
+
+// WaveAnno is the annotation key of resource sync wave. Resources in a lower
+// wave are applied and become ready before resources in higher waves are
+// applied. Resources without the annotation are in wave 0.
+const WaveAnno = "release.caicloud.io/sync-wave"
+
+// WaveOf returns the sync wave of a resource. Invalid waves are treated as 0.
+func WaveOf(r string) int {
+	res := resource{}
+	if err := yaml.Unmarshal([]byte(r), &res); err != nil {
+		return 0
+	}
+	value, ok := res.Metadata.Annotations[WaveAnno]
+	if !ok {
+		return 0
+	}
+	wave, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		glog.Warningf("Invalid wave %q of %s %s, use 0 instead", value, res.Kind, res.Metadata.Name)
+		return 0
+	}
+	return wave
+}
+
+// WavesFor returns sorted waves of resources.
+func WavesFor(resources []string) []int {
+	set := make(map[int]bool)
+	for _, r := range resources {
+		set[WaveOf(r)] = true
+	}
+	waves := make([]int, 0, len(set))
+	for w := range set {
+		waves = append(waves, w)
+	}
+	sort.Ints(waves)
+	return waves
+}
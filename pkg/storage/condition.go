@@ -9,11 +9,21 @@ import (
 type releaseConditionReason string
 
 const (
-	ReleaseReasonAvailable   releaseConditionReason = "Available"
-	ReleaseReasonFailure     releaseConditionReason = "Failure"
-	ReleaseReasonCreating    releaseConditionReason = "Creating"
-	ReleaseReasonUpdating    releaseConditionReason = "Updating"
-	ReleaseReasonRollbacking releaseConditionReason = "Rollbacking"
+	ReleaseReasonAvailable         releaseConditionReason = "Available"
+	ReleaseReasonFailure           releaseConditionReason = "Failure"
+	ReleaseReasonCreating          releaseConditionReason = "Creating"
+	ReleaseReasonUpdating          releaseConditionReason = "Updating"
+	ReleaseReasonRollbacking       releaseConditionReason = "Rollbacking"
+	ReleaseReasonHookSucceeded     releaseConditionReason = "HookSucceeded"
+	ReleaseReasonHookFailed        releaseConditionReason = "HookFailed"
+	ReleaseReasonRenderFailed      releaseConditionReason = "RenderFailed"
+	ReleaseReasonWaveApplying      releaseConditionReason = "WaveApplying"
+	ReleaseReasonWaveSucceeded     releaseConditionReason = "WaveSucceeded"
+	ReleaseReasonWaveFailed        releaseConditionReason = "WaveFailed"
+	ReleaseReasonApplyConflict     releaseConditionReason = "ApplyConflict"
+	ReleaseReasonPVCShrinkRejected releaseConditionReason = "PVCShrinkRejected"
+	ReleaseReasonDryRun            releaseConditionReason = "DryRun"
+	ReleaseReasonValuesUnavailable releaseConditionReason = "ValuesUnavailable"
 )
 
 // Condition returns a release condition based on given release condition reason.
@@ -25,11 +35,11 @@ func Condition(r releaseConditionReason, msg string) releaseapi.ReleaseCondition
 		Reason:             string(r),
 	}
 	switch r {
-	case ReleaseReasonAvailable:
+	case ReleaseReasonAvailable, ReleaseReasonHookSucceeded, ReleaseReasonWaveSucceeded, ReleaseReasonDryRun:
 		ret.Type = releaseapi.ReleaseAvailable
-	case ReleaseReasonFailure:
+	case ReleaseReasonFailure, ReleaseReasonHookFailed, ReleaseReasonRenderFailed, ReleaseReasonWaveFailed, ReleaseReasonApplyConflict, ReleaseReasonPVCShrinkRejected, ReleaseReasonValuesUnavailable:
 		ret.Type = releaseapi.ReleaseFailure
-	case ReleaseReasonCreating, ReleaseReasonUpdating, ReleaseReasonRollbacking:
+	case ReleaseReasonCreating, ReleaseReasonUpdating, ReleaseReasonRollbacking, ReleaseReasonWaveApplying:
 		ret.Type = releaseapi.ReleaseProgressing
 	}
 	return ret
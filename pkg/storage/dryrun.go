@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	"github.com/caicloud/rudder/pkg/kube"
+)
+
+const (
+	// AnnotationDryRun marks a release to be applied with server-side dry-run
+	// when it's "true". The release is rendered and sent to the api server, but
+	// nothing is persisted, no hook is executed and the version is not changed.
+	AnnotationDryRun = "release.caicloud.io/dry-run"
+	// AnnotationDryRunResults contains results of the last dry-run. It's a json
+	// list of kube.DryRunResult.
+	AnnotationDryRunResults = "release.caicloud.io/dry-run-results"
+)
+
+// DryRun checks if a release should be applied with dry-run.
+func DryRun(release *releaseapi.Release) bool {
+	return release.Annotations[AnnotationDryRun] == "true"
+}
+
+// SetDryRunResults records results of dry-run into a release.
+func SetDryRunResults(release *releaseapi.Release, results []kube.DryRunResult) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	if release.Annotations == nil {
+		release.Annotations = make(map[string]string)
+	}
+	release.Annotations[AnnotationDryRunResults] = string(data)
+	return nil
+}
+
+// DryRunResults returns results of the last dry-run of a release. It returns nil
+// if the release has never been dry-run.
+func DryRunResults(release *releaseapi.Release) ([]kube.DryRunResult, error) {
+	value, ok := release.Annotations[AnnotationDryRunResults]
+	if !ok || value == "" {
+		return nil, nil
+	}
+	results := []kube.DryRunResult{}
+	if err := json.Unmarshal([]byte(value), &results); err != nil {
+		return nil, fmt.Errorf("invalid dry-run results of release %s/%s: %v", release.Namespace, release.Name, err)
+	}
+	return results, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"time"
 
 	releasev1alpha1 "github.com/caicloud/clientset/kubernetes/typed/release/v1alpha1"
 	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
@@ -12,12 +13,14 @@ import (
 	"github.com/caicloud/rudder/pkg/render"
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
 const (
@@ -26,11 +29,33 @@ const (
 	LabelReleaseName = "release.caicloud.io/name"
 	// LabelReleaseVersion is the version of release history
 	LabelReleaseVersion = "release.caicloud.io/version"
+
+	// AnnotationRenderTime is the time when a version of release was rendered
+	// for the first time. All renders of the version should use the time.
+	AnnotationRenderTime = "release.caicloud.io/render-time"
+	// AnnotationNotes is the rendered NOTES.txt of the top-level chart. It's
+	// kept in both release and history.
+	AnnotationNotes = "release.caicloud.io/notes"
+	// AnnotationRenderError is a json of render.RenderError. It's kept in a
+	// release if the release failed to render.
+	AnnotationRenderError = "release.caicloud.io/render-error"
+	// AnnotationForceConflicts takes ownership of conflicting fields from other
+	// managers when it's "true" and resources are applied with server-side apply.
+	AnnotationForceConflicts = "release.caicloud.io/force-conflicts"
+	// AnnotationPatches is a json list of post-render patches which a version of
+	// release was rendered with. All renders of the version should use them, even
+	// if patches of the controller are changed. It's kept in histories.
+	AnnotationPatches = "release.caicloud.io/patches"
+
+	// FinalizerPreDeleteHooks is the finalizer of releases which have pre-delete
+	// hooks. It's removed after the hooks are executed.
+	FinalizerPreDeleteHooks = "release.caicloud.io/pre-delete-hooks"
 )
 
 var (
 	gvkRelease        = releaseapi.SchemeGroupVersion.WithKind("Release")
 	gvkReleaseHistory = releaseapi.SchemeGroupVersion.WithKind("ReleaseHistory")
+	gvkSecret         = core.SchemeGroupVersion.WithKind("Secret")
 )
 
 // ReleaseBackend is a backend for releases and release histories.
@@ -51,12 +76,16 @@ type ReleaseHolder interface {
 	// Release returns a cached release. It may be not a latest one.
 	// Don't use the release to cover running release.
 	Release() (*releaseapi.Release, error)
-	// Update updates the release.
-	Update(release *releaseapi.Release) (*releaseapi.Release, error)
+	// Update updates the release. secretValues are values from Secret layers of
+	// the version. They are kept in a Secret owned by the history of the version
+	// when the history is created.
+	Update(release *releaseapi.Release, secretValues string) (*releaseapi.Release, error)
 	// Patch patches the release with a modifier.
 	Patch(modifier func(release *releaseapi.Release)) (*releaseapi.Release, error)
-	// Rollback rollbacks running release to specified version.
-	Rollback(version int32) (*releaseapi.Release, error)
+	// Rollback rollbacks running release to specified version. The version is
+	// rendered with its effective config. rollbackValues is the provenance of
+	// values layers of the version at present, and it's recorded in the release.
+	Rollback(version int32, rollbackValues string) (*releaseapi.Release, error)
 	// Delete deletes the release.
 	Delete() error
 }
@@ -77,13 +106,21 @@ type ReleaseHistoryHolder interface {
 	History(version int32) (*releaseapi.ReleaseHistory, error)
 	// Histories returns all histories of release.
 	Histories() ([]releaseapi.ReleaseHistory, error)
+	// HistoryConfig returns the effective config which a history was rendered
+	// with. A *ValuesSnapshotError is returned if the config can't be restored.
+	HistoryConfig(history *releaseapi.ReleaseHistory) (string, error)
 }
 
-// NewReleaseBackendWithCacheLayer creates a release backend.
-func NewReleaseBackendWithCacheLayer(client releasev1alpha1.ReleaseV1alpha1Interface, layers kube.CacheLayers) ReleaseBackend {
+// NewReleaseBackendWithCacheLayer creates a release backend. secrets keep values
+// from Secret layers of histories. caps and cache are used to render templates
+// when rollback.
+func NewReleaseBackendWithCacheLayer(client releasev1alpha1.ReleaseV1alpha1Interface, secrets corev1.SecretsGetter, layers kube.CacheLayers, caps render.CapabilitiesSource, cache *render.Cache) ReleaseBackend {
 	return &releaseBackend{
-		client: client,
-		layers: layers,
+		client:  client,
+		secrets: secrets,
+		layers:  layers,
+		caps:    caps,
+		cache:   cache,
 	}
 }
 
@@ -95,19 +132,28 @@ func NewReleaseBackend(client releasev1alpha1.ReleaseV1alpha1Interface) ReleaseB
 }
 
 type releaseBackend struct {
-	client releasev1alpha1.ReleaseV1alpha1Interface
-	layers kube.CacheLayers
+	client  releasev1alpha1.ReleaseV1alpha1Interface
+	secrets corev1.SecretsGetter
+	layers  kube.CacheLayers
+	caps    render.CapabilitiesSource
+	cache   *render.Cache
 }
 
 // ReleaseStorage returns a corresponding storage for the release.
 func (rb *releaseBackend) ReleaseStorage(release *releaseapi.Release) ReleaseStorage {
-	return &releaseStorage{
+	rs := &releaseStorage{
 		name:                 release.Name,
 		release:              release.DeepCopy(),
 		releaseClient:        rb.client.Releases(release.Namespace),
 		releaseHistoryClient: rb.client.ReleaseHistories(release.Namespace),
 		layers:               rb.layers,
+		caps:                 rb.caps,
+		cache:                rb.cache,
+	}
+	if rb.secrets != nil {
+		rs.secretClient = rb.secrets.Secrets(release.Namespace)
 	}
+	return rs
 }
 
 type releaseStorage struct {
@@ -115,7 +161,10 @@ type releaseStorage struct {
 	release              *releaseapi.Release
 	releaseClient        releasev1alpha1.ReleaseInterface
 	releaseHistoryClient releasev1alpha1.ReleaseHistoryInterface
+	secretClient         corev1.SecretInterface
 	layers               kube.CacheLayers
+	caps                 render.CapabilitiesSource
+	cache                *render.Cache
 }
 
 const (
@@ -172,25 +221,44 @@ func (rs *releaseStorage) own(history *releaseapi.ReleaseHistory) bool {
 		or.UID == rs.release.UID
 }
 
-// Update updates the release.
-func (rs *releaseStorage) Update(release *releaseapi.Release) (*releaseapi.Release, error) {
+// Update updates the release. secretValues are values from Secret layers of
+// the version. They are kept in a Secret owned by the history of the version
+// when the history is created.
+func (rs *releaseStorage) Update(release *releaseapi.Release, secretValues string) (*releaseapi.Release, error) {
 	_, err := rs.History(release.Status.Version)
 	if err != nil && !errors.IsNotFound(err) {
 		return nil, err
 	}
 	// if the history doesn't exist, create it
-	if err != nil {
+	created := err != nil
+	if created {
 		history := constructReleaseHistory(release, release.Status.Version)
-		_, err := rs.releaseHistoryClient.Create(history)
+		if secretValues != "" {
+			history.Annotations[AnnotationValuesSecret] = generateValuesSecretName(history.Name)
+		}
+		history, err := rs.releaseHistoryClient.Create(history)
 		if err != nil {
 			return nil, err
 		}
+		if secretValues != "" {
+			if err := rs.createValuesSecret(history, secretValues); err != nil {
+				// A history without its values can't be rendered again.
+				if e := rs.releaseHistoryClient.Delete(history.Name, &metav1.DeleteOptions{}); e != nil {
+					glog.Errorf("Failed to delete history %s/%s without values: %v", history.Namespace, history.Name, e)
+				}
+				return nil, err
+			}
+		}
 		if err := rs.withLayer(gvkReleaseHistory, history, actionCreated); err != nil {
 			return nil, err
 		}
 	}
 	// Update release
 	return rs.Patch(func(rel *releaseapi.Release) {
+		if created {
+			delete(rel.Annotations, AnnotationRollbackValues)
+		}
+		SetNotes(rel, release.Annotations[AnnotationNotes])
 		rel.Status.LastUpdateTime = metav1.Now()
 		rel.Status.Manifest = release.Status.Manifest
 		rel.Status.Version = release.Status.Version
@@ -230,8 +298,10 @@ func (rs *releaseStorage) Patch(modifier func(release *releaseapi.Release)) (*re
 	return rs.release, nil
 }
 
-// Rollback rollbacks running release to specified version.
-func (rs *releaseStorage) Rollback(version int32) (*releaseapi.Release, error) {
+// Rollback rollbacks running release to specified version. The version is
+// rendered with its effective config. rollbackValues is the provenance of values
+// layers of the version at present, and it's recorded in the release.
+func (rs *releaseStorage) Rollback(version int32, rollbackValues string) (*releaseapi.Release, error) {
 	history, err := rs.History(version)
 	if err != nil && !errors.IsNotFound(err) {
 		return nil, err
@@ -240,16 +310,27 @@ func (rs *releaseStorage) Rollback(version int32) (*releaseapi.Release, error) {
 		// Record condition.
 		return rs.FlushConditions(Condition(ReleaseReasonFailure, err.Error()))
 	}
+	patches, err := HistoryPatches(history)
+	if err != nil {
+		return nil, err
+	}
+	config, err := rs.HistoryConfig(history)
+	if err != nil {
+		return nil, err
+	}
 	// FIX: use temporary render to avoid concurrent issue
 	// need render again instead of using history's manifest directly because of the history's manifest
 	// remained suspend status when be generated.
-	carrier, err := render.NewRender().Render(&render.Options{
-		Namespace: rs.release.Namespace,
-		Release:   rs.release.Name,
-		Version:   history.Spec.Version,
-		Template:  history.Spec.Template,
-		Config:    history.Spec.Config,
-		Suspend:   rs.release.Spec.Suspend,
+	carrier, err := render.NewRenderWithCache(rs.cache).Render(&render.Options{
+		Namespace:    rs.release.Namespace,
+		Release:      rs.release.Name,
+		Version:      history.Spec.Version,
+		Template:     history.Spec.Template,
+		Config:       config,
+		Suspend:      rs.release.Spec.Suspend,
+		Capabilities: rs.caps,
+		Time:         RenderTime(history),
+		Patches:      patches,
 	})
 	if err != nil {
 		return nil, err
@@ -260,6 +341,23 @@ func (rs *releaseStorage) Rollback(version int32) (*releaseapi.Release, error) {
 		release.Spec.Template = history.Spec.Template
 		release.Spec.Config = history.Spec.Config
 		release.Spec.RollbackTo = nil
+		if layers, ok := history.Annotations[AnnotationValuesLayers]; ok {
+			if release.Annotations == nil {
+				release.Annotations = make(map[string]string)
+			}
+			release.Annotations[AnnotationValuesLayers] = layers
+		} else {
+			delete(release.Annotations, AnnotationValuesLayers)
+		}
+		if rollbackValues != "" {
+			if release.Annotations == nil {
+				release.Annotations = make(map[string]string)
+			}
+			release.Annotations[AnnotationRollbackValues] = rollbackValues
+		} else {
+			delete(release.Annotations, AnnotationRollbackValues)
+		}
+		SetNotes(release, carrier.Notes())
 		release.Status.Version = history.Spec.Version
 		release.Status.LastUpdateTime = metav1.Now()
 		release.Status.Manifest = render.MergeResources(manifests)
@@ -358,6 +456,85 @@ func (rs *releaseStorage) Histories() (results []releaseapi.ReleaseHistory, err
 	return results, nil
 }
 
+// HistoryConfig returns the effective config which a history was rendered with.
+// A *ValuesSnapshotError is returned if the config can't be restored.
+func (rs *releaseStorage) HistoryConfig(history *releaseapi.ReleaseHistory) (string, error) {
+	if _, ok := history.Annotations[AnnotationValuesProvenance]; !ok {
+		// The history has no values layers.
+		return history.Spec.Config, nil
+	}
+	config, ok := history.Annotations[AnnotationEffectiveConfig]
+	if !ok {
+		return "", &ValuesSnapshotError{history.Name, "effective config is not recorded"}
+	}
+	if name, ok := history.Annotations[AnnotationValuesSecret]; ok {
+		secret, err := rs.valuesSecret(name)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return "", &ValuesSnapshotError{history.Name, fmt.Sprintf("secret %s doesn't exist", name)}
+			}
+			return "", err
+		}
+		if !ownedByHistory(secret, history) {
+			return "", &ValuesSnapshotError{history.Name, fmt.Sprintf("secret %s doesn't belong to the history", name)}
+		}
+		values, ok := secret.Data[valuesSecretKey]
+		if !ok {
+			return "", &ValuesSnapshotError{history.Name, fmt.Sprintf("no key %s in secret %s", valuesSecretKey, name)}
+		}
+		config, err = render.MergeConfig(config, []render.ValuesLayer{{Name: "secret/" + name, Values: string(values)}})
+		if err != nil {
+			return "", &ValuesSnapshotError{history.Name, err.Error()}
+		}
+	}
+	if ConfigDigest(config) != history.Annotations[AnnotationValuesDigest] {
+		return "", &ValuesSnapshotError{history.Name, "restored config doesn't match its digest"}
+	}
+	return config, nil
+}
+
+// createValuesSecret creates the values Secret of a history. An existing Secret
+// which is left by a deleted history with the same name is replaced.
+func (rs *releaseStorage) createValuesSecret(history *releaseapi.ReleaseHistory, values string) error {
+	if rs.secretClient == nil {
+		return fmt.Errorf("no client to save values of history %s/%s", history.Namespace, history.Name)
+	}
+	secret := constructValuesSecret(history, values)
+	created, err := rs.secretClient.Create(secret)
+	if errors.IsAlreadyExists(err) {
+		var existing *core.Secret
+		existing, err = rs.secretClient.Get(secret.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		secret.ResourceVersion = existing.ResourceVersion
+		created, err = rs.secretClient.Update(secret)
+	}
+	if err != nil {
+		return err
+	}
+	return rs.withLayer(gvkSecret, created, actionCreated)
+}
+
+// valuesSecret gets a values Secret.
+func (rs *releaseStorage) valuesSecret(name string) (*core.Secret, error) {
+	if rs.layers != nil {
+		layer, err := rs.layers.LayerFor(gvkSecret)
+		if err != nil {
+			return nil, err
+		}
+		obj, err := layer.ByNamespace(rs.release.Namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return obj.(*core.Secret), nil
+	}
+	if rs.secretClient == nil {
+		return nil, fmt.Errorf("no client to get values secret %s/%s", rs.release.Namespace, name)
+	}
+	return rs.secretClient.Get(name, metav1.GetOptions{})
+}
+
 // UpdateStatus update the status of running release.
 func (rs *releaseStorage) UpdateStatus(modifier func(status *releaseapi.ReleaseStatus)) (*releaseapi.Release, error) {
 	return rs.Patch(func(release *releaseapi.Release) {
@@ -379,6 +556,141 @@ func (rs *releaseStorage) FlushConditions(conditions ...releaseapi.ReleaseCondit
 	})
 }
 
+// RenderTime returns the render time of a history. For histories without render
+// time, the creation time is used.
+func RenderTime(history *releaseapi.ReleaseHistory) time.Time {
+	if value, ok := history.Annotations[AnnotationRenderTime]; ok {
+		t, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return t
+		}
+		glog.Errorf("Invalid render time %q of history %s/%s: %v", value, history.Namespace, history.Name, err)
+	}
+	return history.CreationTimestamp.Time
+}
+
+// SetRenderTime records the render time of current version into a release. The
+// time is saved into the history of the version when the release is updated.
+func SetRenderTime(release *releaseapi.Release, t time.Time) {
+	if release.Annotations == nil {
+		release.Annotations = make(map[string]string)
+	}
+	release.Annotations[AnnotationRenderTime] = t.Format(time.RFC3339)
+}
+
+// SetPatches records post-render patches of current version into a release. They
+// are saved into the history of the version when the release is updated.
+func SetPatches(release *releaseapi.Release, patches []*render.Patch) error {
+	if len(patches) <= 0 {
+		delete(release.Annotations, AnnotationPatches)
+		return nil
+	}
+	data, err := json.Marshal(patches)
+	if err != nil {
+		return err
+	}
+	if release.Annotations == nil {
+		release.Annotations = make(map[string]string)
+	}
+	release.Annotations[AnnotationPatches] = string(data)
+	return nil
+}
+
+// HistoryPatches returns post-render patches which a history was rendered with.
+// Histories without patches return nil.
+func HistoryPatches(history *releaseapi.ReleaseHistory) ([]*render.Patch, error) {
+	value, ok := history.Annotations[AnnotationPatches]
+	if !ok || value == "" {
+		return nil, nil
+	}
+	patches := []*render.Patch{}
+	if err := json.Unmarshal([]byte(value), &patches); err != nil {
+		return nil, fmt.Errorf("invalid patches of history %s/%s: %v", history.Namespace, history.Name, err)
+	}
+	return patches, nil
+}
+
+// SetNotes records the notes of current version into a release. The notes are
+// saved into both the release and the history of the version when the release
+// is updated. Empty notes remove the annotation.
+func SetNotes(release *releaseapi.Release, notes string) {
+	if notes == "" {
+		delete(release.Annotations, AnnotationNotes)
+		return
+	}
+	if release.Annotations == nil {
+		release.Annotations = make(map[string]string)
+	}
+	release.Annotations[AnnotationNotes] = notes
+}
+
+// SetRenderError records a render error into a release. A nil err removes the
+// recorded one.
+func SetRenderError(release *releaseapi.Release, err *render.RenderError) {
+	if err == nil {
+		delete(release.Annotations, AnnotationRenderError)
+		return
+	}
+	data, e := json.Marshal(err)
+	if e != nil {
+		glog.Errorf("Can't marshal render error of release %s/%s: %v", release.Namespace, release.Name, e)
+		return
+	}
+	if release.Annotations == nil {
+		release.Annotations = make(map[string]string)
+	}
+	release.Annotations[AnnotationRenderError] = string(data)
+}
+
+// RenderError returns the render error recorded in a release. It returns nil if
+// there is no render error.
+func RenderError(release *releaseapi.Release) (*render.RenderError, error) {
+	value, ok := release.Annotations[AnnotationRenderError]
+	if !ok {
+		return nil, nil
+	}
+	err := &render.RenderError{}
+	if e := json.Unmarshal([]byte(value), err); e != nil {
+		return nil, e
+	}
+	return err, nil
+}
+
+// HasFinalizer checks if a release has the finalizer of pre-delete hooks.
+func HasFinalizer(release *releaseapi.Release) bool {
+	for _, f := range release.Finalizers {
+		if f == FinalizerPreDeleteHooks {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFinalizer adds the finalizer of pre-delete hooks to a release if set is true,
+// or removes it if set is false. Other finalizers are kept.
+func SetFinalizer(release *releaseapi.Release, set bool) {
+	if HasFinalizer(release) == set {
+		return
+	}
+	if set {
+		release.Finalizers = append(release.Finalizers, FinalizerPreDeleteHooks)
+		return
+	}
+	finalizers := make([]string, 0, len(release.Finalizers))
+	for _, f := range release.Finalizers {
+		if f != FinalizerPreDeleteHooks {
+			finalizers = append(finalizers, f)
+		}
+	}
+	release.Finalizers = finalizers
+}
+
+// ForceConflicts checks if a release takes ownership of conflicting fields in
+// server-side apply.
+func ForceConflicts(release *releaseapi.Release) bool {
+	return release.Annotations[AnnotationForceConflicts] == "true"
+}
+
 // generateReleaseHistoryName generates the name of release history.
 func generateReleaseHistoryName(name string, version int32) string {
 	return fmt.Sprintf("%s-v%d", name, version)
@@ -386,6 +698,10 @@ func generateReleaseHistoryName(name string, version int32) string {
 
 // constructReleaseHistory generates a release history for a release.
 func constructReleaseHistory(release *releaseapi.Release, version int32) *releaseapi.ReleaseHistory {
+	annotations := make(map[string]string, len(release.Annotations))
+	for k, v := range release.Annotations {
+		annotations[k] = v
+	}
 	// Create History
 	return &releaseapi.ReleaseHistory{
 		ObjectMeta: metav1.ObjectMeta{
@@ -401,7 +717,7 @@ func constructReleaseHistory(release *releaseapi.Release, version int32) *releas
 				Name:       release.Name,
 				UID:        release.UID,
 			}},
-			Annotations: release.Annotations,
+			Annotations: annotations,
 		},
 		Spec: releaseapi.ReleaseHistorySpec{
 			Description: release.Spec.Description,
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	releaseapi "github.com/caicloud/clientset/pkg/apis/release/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AnnotationValuesLayers contains an ordered list of values layers of a release.
+	// Layers override Spec.Config in order. References to ConfigMaps and Secrets
+	// are resolved when rendering, and a change of referenced values produces a
+	// new version. For example:
+	//  [
+	//    {"name": "env", "configMapKeyRef": {"name": "env-defaults", "key": "values.yaml"}},
+	//    {"name": "team", "values": {"replicas": 3}},
+	//    {"name": "tag", "secretKeyRef": {"name": "deploy", "key": "image.yaml"}}
+	//  ]
+	AnnotationValuesLayers = "release.caicloud.io/values-layers"
+	// AnnotationValuesProvenance describes where the values layers of a history
+	// come from. It's recorded in histories with AnnotationValuesLayers.
+	AnnotationValuesProvenance = "release.caicloud.io/values-provenance"
+	// AnnotationEffectiveConfig is the config merged from Spec.Config and all
+	// values layers, except values from Secret layers. It's recorded in histories
+	// of releases which have values layers.
+	AnnotationEffectiveConfig = "release.caicloud.io/effective-config"
+	// AnnotationValuesSecret is the name of a Secret which keeps values from
+	// Secret layers of a history. The Secret is owned by the history. Its values
+	// are merged into AnnotationEffectiveConfig to restore the effective config.
+	AnnotationValuesSecret = "release.caicloud.io/values-secret"
+	// AnnotationValuesDigest is the sha256 digest of the effective config of a
+	// history. A restored config must have the same digest.
+	AnnotationValuesDigest = "release.caicloud.io/values-digest"
+	// AnnotationRollbackValues is the provenance of values layers when a release
+	// was rolled back. Referenced values which were changed before the rollback
+	// don't produce a new version. It's kept in releases until a new version is
+	// created.
+	AnnotationRollbackValues = "release.caicloud.io/rollback-values"
+
+	// valuesSecretKey is the key of values in a values Secret.
+	valuesSecretKey = "values"
+)
+
+// ValuesLayerSource describes where a values layer comes from. Only one of
+// Values, ConfigMapKeyRef and SecretKeyRef should be set.
+type ValuesLayerSource struct {
+	// Name is the name of the layer.
+	Name string `json:"name"`
+	// Values is an inline json object or a yaml string.
+	Values json.RawMessage `json:"values,omitempty"`
+	// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of release.
+	ConfigMapKeyRef *core.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef selects a key of a Secret in the namespace of release.
+	SecretKeyRef *core.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// ValuesProvenance records the source and content digest of a values layer.
+type ValuesProvenance struct {
+	// Name is the name of the layer.
+	Name string `json:"name"`
+	// Source is one of:
+	//  inline
+	//  configmap/<name>/<key>
+	//  secret/<name>/<key>
+	Source string `json:"source"`
+	// Digest is the sha256 digest of layer content. It's empty if an optional
+	// reference doesn't exist.
+	Digest string `json:"digest,omitempty"`
+}
+
+// ValuesLayers returns values layers of a release.
+func ValuesLayers(release *releaseapi.Release) ([]ValuesLayerSource, error) {
+	layers, err := valuesLayers(release.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid values layers of release %s/%s: %v", release.Namespace, release.Name, err)
+	}
+	return layers, nil
+}
+
+// HistoryValuesLayers returns values layers which a history was rendered with.
+func HistoryValuesLayers(history *releaseapi.ReleaseHistory) ([]ValuesLayerSource, error) {
+	layers, err := valuesLayers(history.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid values layers of history %s/%s: %v", history.Namespace, history.Name, err)
+	}
+	return layers, nil
+}
+
+// valuesLayers parses values layers in annotations.
+func valuesLayers(annotations map[string]string) ([]ValuesLayerSource, error) {
+	value, ok := annotations[AnnotationValuesLayers]
+	if !ok || value == "" {
+		return nil, nil
+	}
+	layers := []ValuesLayerSource{}
+	if err := json.Unmarshal([]byte(value), &layers); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+// SetEffectiveValues records the provenance of values layers and the effective
+// config into a release. config must not contain values from Secret layers, and
+// digest is the digest of the whole effective config. They are saved into the
+// history of the version when the release is updated. Releases without layers
+// record nothing.
+func SetEffectiveValues(release *releaseapi.Release, provenance []ValuesProvenance, config string, digest string) error {
+	if len(provenance) <= 0 {
+		delete(release.Annotations, AnnotationValuesProvenance)
+		delete(release.Annotations, AnnotationEffectiveConfig)
+		delete(release.Annotations, AnnotationValuesDigest)
+		return nil
+	}
+	data, err := json.Marshal(provenance)
+	if err != nil {
+		return err
+	}
+	if release.Annotations == nil {
+		release.Annotations = make(map[string]string)
+	}
+	release.Annotations[AnnotationValuesProvenance] = string(data)
+	release.Annotations[AnnotationEffectiveConfig] = config
+	release.Annotations[AnnotationValuesDigest] = digest
+	return nil
+}
+
+// ConfigDigest returns the digest of an effective config.
+func ConfigDigest(config string) string {
+	sum := sha256.Sum256([]byte(config))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValuesSnapshotError is returned when the effective config of a history can't
+// be restored.
+type ValuesSnapshotError struct {
+	// History is the name of the history.
+	History string
+	// Reason describes why the config can't be restored.
+	Reason string
+}
+
+func (e *ValuesSnapshotError) Error() string {
+	return fmt.Sprintf("can't restore values of history %s: %s", e.History, e.Reason)
+}
+
+// generateValuesSecretName generates the name of the values Secret of a history.
+func generateValuesSecretName(history string) string {
+	return history + "-values"
+}
+
+// constructValuesSecret generates a Secret which keeps values from Secret layers
+// of a history.
+func constructValuesSecret(history *releaseapi.ReleaseHistory, values string) *core.Secret {
+	return &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      history.Annotations[AnnotationValuesSecret],
+			Namespace: history.Namespace,
+			Labels: map[string]string{
+				LabelReleaseName:    history.Labels[LabelReleaseName],
+				LabelReleaseVersion: history.Labels[LabelReleaseVersion],
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: releaseapi.SchemeGroupVersion.String(),
+				Kind:       gvkReleaseHistory.Kind,
+				Name:       history.Name,
+				UID:        history.UID,
+			}},
+		},
+		Type: core.SecretTypeOpaque,
+		Data: map[string][]byte{
+			valuesSecretKey: []byte(values),
+		},
+	}
+}
+
+// ownedByHistory checks if a Secret belongs to a history.
+func ownedByHistory(secret *core.Secret, history *releaseapi.ReleaseHistory) bool {
+	for _, or := range secret.OwnerReferences {
+		if or.Kind == gvkReleaseHistory.Kind && or.Name == history.Name && or.UID == history.UID {
+			return true
+		}
+	}
+	return false
+}
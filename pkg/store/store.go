@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"sync"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/caicloud/rudder/pkg/kube"
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -35,43 +37,73 @@ type integrationStore struct {
 	lock      sync.RWMutex
 	resources kube.APIResources
 	factory   informers.SharedInformerFactory
+	pool      kube.ClientPool
 	informers map[schema.GroupVersionKind]*cacheInformer
 	ttl       time.Duration
 	stopCh    <-chan struct{}
 }
 
 // NewIntegrationStoreWithTTL creates a IntegrationStore with a default cache TTL.
-func NewIntegrationStoreWithTTL(resources kube.APIResources, factory informers.SharedInformerFactory, ttl time.Duration, stopCh <-chan struct{}) IntegrationStore {
-	return &integrationStore{
+// Kinds which are not supported by factory are watched as unstructured objects
+// with clients from pool.
+func NewIntegrationStoreWithTTL(resources kube.APIResources, factory informers.SharedInformerFactory, pool kube.ClientPool, ttl time.Duration, stopCh <-chan struct{}) IntegrationStore {
+	is := &integrationStore{
 		resources: resources,
 		factory:   factory,
+		pool:      pool,
 		informers: make(map[schema.GroupVersionKind]*cacheInformer),
 		ttl:       ttl,
 		stopCh:    stopCh,
 	}
+	resources.OnRemove(is.invalidate)
+	return is
 }
 
 // NewIntegrationStore creates a IntegrationStore.
-func NewIntegrationStore(resources kube.APIResources, factory informers.SharedInformerFactory, stopCh <-chan struct{}) IntegrationStore {
-	return NewIntegrationStoreWithTTL(resources, factory, DefaultTTL, stopCh)
+func NewIntegrationStore(resources kube.APIResources, factory informers.SharedInformerFactory, pool kube.ClientPool, stopCh <-chan struct{}) IntegrationStore {
+	return NewIntegrationStoreWithTTL(resources, factory, pool, DefaultTTL, stopCh)
 }
 
 func (is *integrationStore) informerFor(gvk schema.GroupVersionKind) (*cacheInformer, error) {
+	// Get the resource and the client out of the lock. They may refresh api
+	// resources and invalidate informers, which takes the lock.
+	resource, err := is.resources.ResourceFor(gvk)
+	if err != nil {
+		return nil, err
+	}
+	gi, err := is.factory.ForResource(resource.GroupVersionResource())
+	var client *kube.ResourceClient
+	if err != nil {
+		// The factory only has informers for built-in kinds.
+		client, err = is.pool.ClientFor(gvk, metav1.NamespaceAll)
+		if err != nil {
+			return nil, err
+		}
+	}
 	is.lock.Lock()
 	defer is.lock.Unlock()
 	informer, ok := is.informers[gvk]
 	if !ok {
-		resource, err := is.resources.ResourceFor(gvk)
-		if err != nil {
-			return nil, err
-		}
-		gi, err := is.factory.ForResource(resource.GroupVersionResource())
-		if err != nil {
-			return nil, err
+		var cancel context.CancelFunc
+		if client != nil {
+			ui := newUnstructuredInformer(client, resource.GroupVersionResource().GroupResource())
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				select {
+				case <-is.stopCh:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			go ui.Informer().Run(ctx.Done())
+			gi = ui
+		} else {
+			is.factory.Start(is.stopCh)
 		}
 		informer = newCacheInformer(gi, resource.GroupVersionResource(), is.ttl)
+		informer.cancel = cancel
 		is.informers[gvk] = informer
-		is.factory.Start(is.stopCh)
 		if !cache.WaitForCacheSync(is.stopCh, gi.Informer().HasSynced) {
 			return nil, fmt.Errorf("can't sync informer for: %s", gvk)
 		}
@@ -79,6 +111,22 @@ func (is *integrationStore) informerFor(gvk schema.GroupVersionKind) (*cacheInfo
 	return informer, nil
 }
 
+// invalidate removes the informer of a kind which is removed from api server.
+// Informers of the shared informer factory can't be stopped, they are only
+// removed from the store.
+func (is *integrationStore) invalidate(gvk schema.GroupVersionKind) {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+	informer, ok := is.informers[gvk]
+	if !ok {
+		return
+	}
+	if informer.cancel != nil {
+		informer.cancel()
+	}
+	delete(is.informers, gvk)
+}
+
 // SharedInformerFactory ...
 func (is *integrationStore) SharedInformerFactory() informers.SharedInformerFactory {
 	return is.factory
@@ -102,12 +150,14 @@ func (is *integrationStore) LayerFor(gvk schema.GroupVersionKind) (kube.CacheLay
 type cacheInformer struct {
 	informer informers.GenericInformer
 	layer    *cacheLayer
+	// cancel stops the informer if it's not from the shared informer factory.
+	cancel context.CancelFunc
 }
 
 func newCacheInformer(informer informers.GenericInformer, gvr schema.GroupVersionResource, ttl time.Duration) *cacheInformer {
 	return &cacheInformer{
-		informer,
-		newCacheLayer(informer.Lister(), gvr.GroupResource(), ttl),
+		informer: informer,
+		layer:    newCacheLayer(informer.Lister(), gvr.GroupResource(), ttl),
 	}
 }
 
@@ -166,8 +216,8 @@ func newCacheLayer(lister cache.GenericLister, gr schema.GroupResource, ttl time
 		switch o := obj.(type) {
 		case *cacheObject:
 			return []string{o.namespace}, nil
-		case metav1.ObjectMetaAccessor:
-			return []string{o.GetObjectMeta().GetNamespace()}, nil
+		case metav1.Object:
+			return []string{o.GetNamespace()}, nil
 		}
 		// It should not come here.
 		panic("Invalid cache object")
@@ -182,13 +232,11 @@ func newCacheLayer(lister cache.GenericLister, gr schema.GroupResource, ttl time
 }
 
 func (c *cacheLayer) get(object runtime.Object) (*cacheObject, bool) {
-	accessor, ok := object.(metav1.ObjectMetaAccessor)
-	if !ok {
+	meta, err := apimeta.Accessor(object)
+	if err != nil {
 		return nil, false
 	}
-	meta := accessor.GetObjectMeta()
 	var co runtime.Object
-	var err error
 	if meta.GetNamespace() == "" {
 		co, err = c.indexLister.Get(meta.GetName())
 	} else {
@@ -201,7 +249,7 @@ func (c *cacheLayer) get(object runtime.Object) (*cacheObject, bool) {
 }
 
 func (c *cacheLayer) add(obj runtime.Object, existing bool) {
-	meta := obj.(metav1.ObjectMetaAccessor).GetObjectMeta()
+	meta, _ := apimeta.Accessor(obj)
 	version, _ := strconv.Atoi(meta.GetResourceVersion())
 	co := &cacheObject{
 		namespace:         meta.GetNamespace(),
@@ -268,7 +316,7 @@ func (c *cacheLayer) listBySelector(selector labels.Selector, lister, cacheListe
 	}
 	count := 0
 	for _, obj := range currentObjs {
-		meta := obj.(metav1.ObjectMetaAccessor).GetObjectMeta()
+		meta, _ := apimeta.Accessor(obj)
 		key := keyForNamespaceAndName(meta.GetNamespace(), meta.GetName())
 		co, ok := cacheObjsMap[key]
 		if ok {
@@ -318,7 +366,7 @@ func (c *cacheLayer) selectObject(current, cacheObj runtime.Object) runtime.Obje
 	objCreationTimestamp := metav1.Time{}
 	resourceVersion := 0
 	if current != nil {
-		meta := current.(metav1.ObjectMetaAccessor).GetObjectMeta()
+		meta, _ := apimeta.Accessor(current)
 		objCreationTimestamp = meta.GetCreationTimestamp()
 		if meta.GetResourceVersion() != "" {
 			resourceVersion, _ = strconv.Atoi(meta.GetResourceVersion())
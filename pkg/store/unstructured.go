@@ -0,0 +1,48 @@
+package store
+
+import (
+	"github.com/caicloud/rudder/pkg/kube"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// unstructuredInformer is a generic informer for kinds which have no typed
+// informer in shared informer factory, such as instances of CRDs. Objects in
+// the informer are *unstructured.Unstructured.
+type unstructuredInformer struct {
+	informer cache.SharedIndexInformer
+	resource schema.GroupResource
+}
+
+// newUnstructuredInformer creates an informer with a client for the kind.
+func newUnstructuredInformer(client *kube.ResourceClient, gr schema.GroupResource) *unstructuredInformer {
+	client = client.AllNamespaces()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.Watch(options)
+		},
+	}
+	informer := cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return &unstructuredInformer{
+		informer: informer,
+		resource: gr,
+	}
+}
+
+// Informer returns the underlying informer.
+func (i *unstructuredInformer) Informer() cache.SharedIndexInformer {
+	return i.informer
+}
+
+// Lister returns a lister of the informer.
+func (i *unstructuredInformer) Lister() cache.GenericLister {
+	return cache.NewGenericLister(i.informer.GetIndexer(), i.resource)
+}